@@ -59,9 +59,15 @@ type baseErr struct {
 func (b *baseErr) Cause() error    { return b.cause }
 func (b *baseErr) Code() string    { return b.code }
 func (b *baseErr) Message() string { return b.message }
-func (b *baseErr) Error() string   { return fmt.Sprintf("%s: %s", b.message, b.cause.Error()) }
 func (b *baseErr) String() string  { return b.Error() }
 
+func (b *baseErr) Error() string {
+	if b.cause == nil {
+		return b.message
+	}
+	return fmt.Sprintf("%s: %s", b.message, b.cause.Error())
+}
+
 // NewError generates the common error structure
 func NewError(err error, code, format string, args ...interface{}) Error {
 	return &baseErr{
@@ -23,6 +23,8 @@ func TestNewError(t *testing.T) {
 	s, ok := err.(fmt.Stringer)
 	assert.True(t, ok)
 	assert.Equal(t, v.Error(), s.String())
+
+	assert.Equal(t, "not found", NewError(nil, ErrorAggregateNotFound, "not found").Error())
 }
 
 func TestIsNotFound(t *testing.T) {
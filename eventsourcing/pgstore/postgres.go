@@ -2,17 +2,19 @@ package pgstore
 
 import (
 	"context"
+	"log/slog"
 	"time"
 
 	"github.com/go-pg/pg"
 	"github.com/insighted4/insighted-go/eventsourcing"
+	"github.com/insighted4/insighted-go/kit/logging"
 	"github.com/sirupsen/logrus"
 )
 
 // Postgres provides a Postgres backed store
 type Postgres struct {
 	db     *pg.DB
-	logger logrus.FieldLogger
+	logger logging.Logger
 }
 
 // Save implements the Store interface and saves records, serialized events, in Postgres
@@ -27,6 +29,15 @@ func (p *Postgres) Load(ctx context.Context, aggregateID string, fromVersion, to
 
 // New returns a Postgres backed store
 func New(options *pg.Options, logger logrus.FieldLogger) *Postgres {
+	return newPostgres(options, logging.FromLogrus(logger))
+}
+
+// NewSlog returns a Postgres backed store logging with a *slog.Logger.
+func NewSlog(options *pg.Options, logger *slog.Logger) *Postgres {
+	return newPostgres(options, logging.FromSlog(logger))
+}
+
+func newPostgres(options *pg.Options, logger logging.Logger) *Postgres {
 	logger = logger.WithField("component", "Postgres")
 
 	db := pg.Connect(options)
@@ -2,10 +2,15 @@ package eventsourcing
 
 import (
 	"context"
+	"log/slog"
 	"reflect"
 	"time"
 
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/logging"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Aggregate represents the aggregate root in the domain driven design sense.
@@ -23,7 +28,9 @@ type Repository struct {
 	store      Store
 	serializer Serializer
 	observers  []func(Event)
-	logger     logrus.FieldLogger
+	logger     logging.Logger
+
+	tracerProvider trace.TracerProvider
 }
 
 // New returns a new instance of the aggregate
@@ -32,15 +39,18 @@ func (r *Repository) New() Aggregate {
 }
 
 // Save persists the events into the underlying Store
-func (r *Repository) Save(ctx context.Context, events ...Event) Error {
+func (r *Repository) Save(ctx context.Context, events ...Event) (err Error) {
 	if len(events) == 0 {
 		return nil
 	}
 	aggregateID := events[0].AggregateID()
 
+	ctx, span := r.startSpan(ctx, "Repository.Save", aggregateID, attribute.Int("events", len(events)))
+	defer func() { endSpan(span, err) }()
+
 	history := make(History, 0, len(events))
 	for _, event := range events {
-		record, err := r.serializer.MarshalEvent(event)
+		record, err := r.marshalEvent(ctx, aggregateID, event)
 		if err != nil {
 			return err
 		}
@@ -48,7 +58,39 @@ func (r *Repository) Save(ctx context.Context, events ...Event) Error {
 		history = append(history, record)
 	}
 
-	return r.store.Save(ctx, aggregateID, history...)
+	storeCtx, storeSpan := r.startSpan(ctx, "Store.Save", aggregateID, attribute.Int("records", len(history)))
+	err = r.store.Save(storeCtx, aggregateID, history...)
+	endSpan(storeSpan, err)
+
+	return err
+}
+
+func (r *Repository) marshalEvent(ctx context.Context, aggregateID string, event Event) (Record, Error) {
+	eventType, _ := EventType(event)
+	_, span := r.startSpan(ctx, "Serializer.MarshalEvent", aggregateID, attribute.String("event.type", eventType))
+	record, err := r.serializer.MarshalEvent(event)
+	endSpan(span, err)
+
+	return record, err
+}
+
+func (r *Repository) unmarshalEvent(ctx context.Context, aggregateID string, record Record) (Event, Error) {
+	_, span := r.startSpan(ctx, "Serializer.UnmarshalEvent", aggregateID, attribute.Int("event.version", record.Version))
+	event, err := r.serializer.UnmarshalEvent(record)
+	endSpan(span, err)
+
+	return event, err
+}
+
+func (r *Repository) loadHistory(ctx context.Context, aggregateID string, fromVersion, toVersion int) (History, Error) {
+	ctx, span := r.startSpan(ctx, "Store.Load", aggregateID)
+	history, err := r.store.Load(ctx, aggregateID, fromVersion, toVersion)
+	if err == nil {
+		span.SetAttributes(attribute.Int("records", len(history)))
+	}
+	endSpan(span, err)
+
+	return history, err
 }
 
 // Load retrieves the specified aggregate from the underlying store
@@ -71,8 +113,11 @@ func (r *Repository) LoadTime(ctx context.Context, aggregateID string, endTime t
 
 // LoadVersion loads the specified aggregate from the store and returns both the Aggregate and the
 // current version number of the aggregate
-func (r *Repository) loadVersion(ctx context.Context, aggregateID string, version int) (Aggregate, int, Error) {
-	history, err := r.store.Load(ctx, aggregateID, 0, version)
+func (r *Repository) loadVersion(ctx context.Context, aggregateID string, version int) (_ Aggregate, _ int, err Error) {
+	ctx, span := r.startSpan(ctx, "Repository.Load", aggregateID, attribute.Int("version", version))
+	defer func() { endSpan(span, err) }()
+
+	history, err := r.loadHistory(ctx, aggregateID, 0, version)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -82,12 +127,15 @@ func (r *Repository) loadVersion(ctx context.Context, aggregateID string, versio
 		return nil, 0, NewError(nil, ErrorAggregateNotFound, "unable to load %v, %v", r.New(), aggregateID)
 	}
 
-	r.logger.Infof("Loaded %v event(s) for aggregate id, %v", entryCount, aggregateID)
+	r.log(ctx).WithFields(logging.Fields{
+		"aggregate_id": aggregateID,
+		"events":       entryCount,
+	}).Info("Loaded events")
 	aggregate := r.New()
 
 	version = 0
 	for _, record := range history {
-		event, err := r.serializer.UnmarshalEvent(record)
+		event, err := r.unmarshalEvent(ctx, aggregateID, record)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -106,8 +154,11 @@ func (r *Repository) loadVersion(ctx context.Context, aggregateID string, versio
 
 // loadTime loads the specified aggregate from the store at some point in time and returns
 // both the Aggregate and the current version number of the aggregate.
-func (r *Repository) loadTime(ctx context.Context, aggregateID string, endTime time.Time) (Aggregate, int, error) {
-	history, err := r.store.Load(ctx, aggregateID, 0, 0)
+func (r *Repository) loadTime(ctx context.Context, aggregateID string, endTime time.Time) (_ Aggregate, _ int, err error) {
+	ctx, span := r.startSpan(ctx, "Repository.Load", aggregateID, attribute.String("time", endTime.Format(time.RFC3339Nano)))
+	defer func() { endSpan(span, err) }()
+
+	history, err := r.loadHistory(ctx, aggregateID, 0, 0)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -117,12 +168,15 @@ func (r *Repository) loadTime(ctx context.Context, aggregateID string, endTime t
 		return nil, 0, NewError(nil, ErrorAggregateNotFound, "unable to load %v, %v", r.New(), aggregateID)
 	}
 
-	r.logger.Infof("Loaded %v event(s) for aggregate id, %v", entryCount, aggregateID)
+	r.log(ctx).WithFields(logging.Fields{
+		"aggregate_id": aggregateID,
+		"events":       entryCount,
+	}).Info("Loaded events")
 	aggregate := r.New()
 
 	version := 0
 	for _, record := range history {
-		event, err := r.serializer.UnmarshalEvent(record)
+		event, err := r.unmarshalEvent(ctx, aggregateID, record)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -145,7 +199,7 @@ func (r *Repository) loadTime(ctx context.Context, aggregateID string, endTime t
 }
 
 // Apply executes the command specified and returns the current version of the aggregate
-func (r *Repository) Apply(ctx context.Context, command Command) (int, Error) {
+func (r *Repository) Apply(ctx context.Context, command Command) (_ int, err Error) {
 	if command == nil {
 		return 0, NewError(nil, ErrorInvalidArgument, "command provided to Repository.Dispatch may not be nil")
 	}
@@ -154,6 +208,10 @@ func (r *Repository) Apply(ctx context.Context, command Command) (int, Error) {
 		return 0, NewError(nil, ErrorInvalidArgument, "command provided to Repository.Dispatch may not contain a blank aggregate ID")
 	}
 
+	commandType := reflect.TypeOf(command).String()
+	ctx, span := r.startSpan(ctx, "Repository.Apply", aggregateID, attribute.String("command.type", commandType))
+	defer func() { endSpan(span, err) }()
+
 	aggregate, version, err := r.loadVersion(ctx, aggregateID, 0)
 	if err != nil {
 		aggregate = r.New()
@@ -189,6 +247,12 @@ func (r *Repository) Apply(ctx context.Context, command Command) (int, Error) {
 	return version, nil
 }
 
+// log returns the repository logger with the request ID and trace context
+// carried by ctx, if any.
+func (r *Repository) log(ctx context.Context) logging.Logger {
+	return r.logger.WithFields(logging.Fields(correlation.Fields(ctx)))
+}
+
 // Store returns the underlying Store
 func (r *Repository) Store() Store {
 	return r.store
@@ -202,6 +266,15 @@ func (r *Repository) Serializer() Serializer {
 // NewRepository creates a new Repository using the JSON serializer and In-Memory store.
 // Observers should invoke very short lived operations as calls will block until the observer is finished.
 func NewRepository(prototype Aggregate, store Store, serializer Serializer, logger logrus.FieldLogger, observers ...func(event Event)) *Repository {
+	return newRepository(prototype, store, serializer, logging.FromLogrus(logger), observers...)
+}
+
+// NewSlogRepository is NewRepository logging with a *slog.Logger.
+func NewSlogRepository(prototype Aggregate, store Store, serializer Serializer, logger *slog.Logger, observers ...func(event Event)) *Repository {
+	return newRepository(prototype, store, serializer, logging.FromSlog(logger), observers...)
+}
+
+func newRepository(prototype Aggregate, store Store, serializer Serializer, logger logging.Logger, observers ...func(event Event)) *Repository {
 	t := reflect.TypeOf(prototype)
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
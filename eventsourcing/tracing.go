@@ -0,0 +1,51 @@
+package eventsourcing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer recording the Repository,
+// Serializer and Store spans. Spans are children of the span carried by the
+// context, eg. the server span of the kit middleware.
+const TracerName = "github.com/insighted4/insighted-go/eventsourcing"
+
+// SetTracerProvider records the spans of the repository with the given
+// provider. By default spans are recorded by the provider of the span carried
+// by the context, or the global OpenTelemetry tracer provider.
+func (r *Repository) SetTracerProvider(provider trace.TracerProvider) {
+	r.tracerProvider = provider
+}
+
+// tracer is looked up per call, so spans follow the provider of the caller
+// rather than the one set when the package was loaded.
+func (r *Repository) tracer(ctx context.Context) trace.Tracer {
+	provider := r.tracerProvider
+	if provider == nil {
+		if span := trace.SpanFromContext(ctx); span.IsRecording() {
+			provider = span.TracerProvider()
+		} else {
+			provider = otel.GetTracerProvider()
+		}
+	}
+	return provider.Tracer(TracerName)
+}
+
+func (r *Repository) startSpan(ctx context.Context, name, aggregateID string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("aggregate.id", aggregateID))
+	return r.tracer(ctx).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, recording err if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
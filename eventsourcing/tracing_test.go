@@ -0,0 +1,97 @@
+package eventsourcing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRepository_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	// spans are recorded by the provider of the parent span.
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	serializer := NewJSONSerializer(EntityCreated{})
+	repository := NewRepository(&Entity{}, NewMemStore(), serializer, logrus.New())
+
+	_, err := repository.Apply(ctx, &CreateEntity{CommandModel: CommandModel{ID: "123"}})
+	assert.Nil(t, err)
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	for _, name := range []string{"Repository.Apply", "Repository.Load", "Store.Load", "Repository.Save", "Serializer.MarshalEvent", "Store.Save"} {
+		assert.Contains(t, spans, name)
+	}
+
+	parentOf := func(name string) string {
+		for _, span := range recorder.Ended() {
+			if span.SpanContext().SpanID() == spans[name].Parent().SpanID() {
+				return span.Name()
+			}
+		}
+		return ""
+	}
+
+	assert.Equal(t, "request", parentOf("Repository.Apply"))
+	assert.Equal(t, "Repository.Apply", parentOf("Repository.Load"))
+	assert.Equal(t, "Repository.Load", parentOf("Store.Load"))
+	assert.Equal(t, "Repository.Apply", parentOf("Repository.Save"))
+	assert.Equal(t, "Repository.Save", parentOf("Serializer.MarshalEvent"))
+	assert.Equal(t, "Repository.Save", parentOf("Store.Save"))
+}
+
+// spanStore records the span carried by the context of the Store calls.
+type spanStore struct {
+	*MemStore
+	spans map[string]trace.SpanContext
+}
+
+func (s spanStore) Save(ctx context.Context, aggregateID string, records ...Record) Error {
+	s.spans["Store.Save"] = trace.SpanContextFromContext(ctx)
+	return s.MemStore.Save(ctx, aggregateID, records...)
+}
+
+func (s spanStore) Load(ctx context.Context, aggregateID string, fromVersion, toVersion int) (History, Error) {
+	s.spans["Store.Load"] = trace.SpanContextFromContext(ctx)
+	return s.MemStore.Load(ctx, aggregateID, fromVersion, toVersion)
+}
+
+func TestRepository_StoreSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	store := spanStore{MemStore: NewMemStore(), spans: map[string]trace.SpanContext{}}
+	repository := NewRepository(&Entity{}, store, NewJSONSerializer(EntityCreated{}), logrus.New())
+	repository.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, err := repository.Apply(context.Background(), &CreateEntity{CommandModel: CommandModel{ID: "123"}})
+	assert.Nil(t, err)
+
+	// the store runs within its own span, so its spans are children of it.
+	for _, span := range recorder.Ended() {
+		if sc, ok := store.spans[span.Name()]; ok {
+			assert.Equal(t, span.SpanContext().SpanID(), sc.SpanID(), span.Name())
+			delete(store.spans, span.Name())
+		}
+	}
+	assert.Empty(t, store.spans)
+}
+
+func TestRepository_SetTracerProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	serializer := NewJSONSerializer(EntityCreated{})
+	repository := NewRepository(&Entity{}, NewMemStore(), serializer, logrus.New())
+	repository.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, err := repository.Apply(context.Background(), &CreateEntity{CommandModel: CommandModel{ID: "123"}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, recorder.Ended())
+}
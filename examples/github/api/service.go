@@ -9,7 +9,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-github/github"
 	"github.com/insighted4/insighted-go/kit"
+	"github.com/insighted4/insighted-go/kit/client"
 	extensions "github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/insighted4/insighted-go/kit/openapi"
 	"google.golang.org/grpc"
 )
 
@@ -19,16 +21,28 @@ type service struct {
 	client *github.Client
 	cfg    kit.Config
 	logger logrus.FieldLogger
+	cors   *extensions.CORS
 }
 
 var _ GithubProxyServer = service{}
 
-func New(cfg kit.Config) kit.Service {
+func New(cfg kit.Config) (kit.Service, error) {
+	logger, err := kit.NewLoggerWithOptions(kit.WithLoggerConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	cors, err := extensions.NewCORS(cfg.CORS)
+	if err != nil {
+		return nil, err
+	}
+
 	return service{
-		client: github.NewClient(nil),
+		client: github.NewClient(client.NewHTTPClient("github", cfg.Client)),
 		cfg:    cfg,
-		logger: kit.NewLogger(cfg.LoggerLevel, cfg.LoggerFormat),
-	}
+		logger: logger,
+		cors:   cors,
+	}, nil
 }
 
 func (s service) Config() kit.Config {
@@ -38,15 +52,29 @@ func (s service) Config() kit.Config {
 func (s service) HTTPHandler() http.Handler {
 	handler := gin.New()
 	handler.Use(gin.Recovery())
-	handler.Use(extensions.CORSHandler())
-	handler.Use(extensions.LoggerHandler(s.logger, time.RFC3339, true))
+	handler.Use(extensions.CORSPolicyHandler(s.cors))
+	handler.Use(extensions.LoggerHandler(s.logger, time.RFC3339, true, kit.LoggerHandlerOptions(s.cfg)...))
 	handler.Use(extensions.RequestIDHandler())
+	handler.Use(extensions.TracingHandler())
+	handler.Use(extensions.ErrorHandler())
 	handler.NoRoute(extensions.NotFoundHandler)
 
 	handler.GET("/", s.RootHandler)
 
-	group := handler.Use(extensions.NoCacheHandler())
-	group.GET(prefix+"/users/:id", s.getUserHTTPHandler)
+	group := handler.Use(extensions.CacheHandler(extensions.CacheConfig{
+		Routes: map[string]extensions.CachePolicy{
+			"GET " + prefix + "/users/:name": {CacheControl: "public, max-age=60", TTL: time.Minute, Vary: []string{"Accept"}},
+		},
+	}))
+	err := kit.RegisterGateway(group, s, kit.GatewayBinding{
+		RPC:    "GetUser",
+		Method: http.MethodGet,
+		Path:   prefix + "/users/{name}",
+	})
+	if err != nil {
+		s.logger.Fatalf("Unable to register gateway: %v", err)
+	}
+
 	return handler
 }
 
@@ -62,8 +90,19 @@ func (s service) RPCServiceDesc() *grpc.ServiceDesc {
 	return &_GithubProxy_serviceDesc
 }
 
+type rootResponse struct {
+	Message string `json:"message"`
+}
+
+// OpenAPIRoutes describes the routes of HTTPHandler not served by the gateway.
+func (s service) OpenAPIRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/", Summary: "Service information", Response: rootResponse{}},
+	}
+}
+
 func (s service) RootHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Github Service",
+	c.JSON(http.StatusOK, rootResponse{
+		Message: "Github Service",
 	})
 }
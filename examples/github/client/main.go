@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/insighted4/insighted-go/examples/github/api"
+	"github.com/insighted4/insighted-go/kit/client"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/grpclog"
 )
@@ -22,7 +23,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	conn, err := grpc.Dial(*serverAddr, grpc.WithInsecure())
+	cfg := client.DefaultConfig()
+	cfg.IdempotentRPCs = []string{"/api.GithubProxy/GetUser"}
+	conn, err := client.Dial(context.Background(), *serverAddr, "github-proxy", cfg, grpc.WithInsecure())
 	if err != nil {
 		grpclog.Fatalf("fail to dial: %v", err)
 	}
@@ -33,10 +36,10 @@ func main() {
 		}
 	}()
 
-	client := api.NewGithubProxyClient(conn)
+	proxy := api.NewGithubProxyClient(conn)
 
 	req := &api.GetUserRequest{Name: flag.Arg(0)}
-	res, err := client.GetUser(context.Background(), req)
+	res, err := proxy.GetUser(context.Background(), req)
 	if err != nil {
 		grpclog.Fatalf("could not get user: %v", err)
 	}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"log"
+
 	"github.com/insighted4/insighted-go/examples/github/api"
 	"github.com/insighted4/insighted-go/kit"
 )
@@ -9,6 +11,15 @@ func main() {
 	cfg := kit.DefaultConfig()
 	cfg.LoggerFormat = "text"
 	cfg.EnablePProf = true
-	svc := api.New(cfg)
-	kit.Run(svc)
+	cfg.EnableOpenAPI = true
+	cfg.OpenAPITitle = "Github Service"
+	cfg.CORS.AllowOrigins = []string{"*"}
+	svc, err := api.New(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := kit.Run(svc); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -9,7 +9,7 @@ import (
 	"strconv"
 
 	"github.com/insighted4/insighted-go/eventsourcing"
-	"github.com/sirupsen/logrus"
+	"github.com/insighted4/insighted-go/kit"
 )
 
 // Order is an example of state generated from left fold of events
@@ -96,7 +96,9 @@ func main() {
 		OrderCreated{},
 		OrderShipped{},
 	)
-	repo := eventsourcing.NewRepository(&Order{}, store, serializer, logrus.New())
+	logger, err := kit.NewLoggerWithOptions(kit.WithLoggerConfig(kit.DefaultConfig()))
+	check(err)
+	repo := eventsourcing.NewRepository(&Order{}, store, serializer, logger)
 
 	id := strconv.FormatInt(time.Now().UnixNano(), 36)
 	ctx := context.Background()
@@ -105,7 +107,7 @@ func main() {
 	create := &CreateOrder{
 		CommandModel: eventsourcing.CommandModel{ID: id},
 	}
-	_, err := repo.Apply(ctx, create)
+	_, err = repo.Apply(ctx, create)
 	check(err)
 
 	// Ship Order
@@ -0,0 +1,128 @@
+package kit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/insighted4/insighted-go/kit/extensions/pprof"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// HealthPath is the admin endpoint reporting the liveness of the server.
+	HealthPath = "/healthz"
+
+	// ReadinessPath is the admin endpoint reporting whether the server accepts traffic.
+	// It turns unavailable as soon as the shutdown starts.
+	ReadinessPath = "/readyz"
+
+	// MetricsPath is the admin endpoint exposing Prometheus metrics.
+	MetricsPath = "/metrics"
+
+	// LogLevelPath is the admin endpoint to read (GET) and change (PUT) the log level.
+	LogLevelPath = "/loglevel"
+)
+
+// AdminService allows a service to mount additional operational endpoints
+// on the admin listener, next to the ones provided by the kit server.
+type AdminService interface {
+	AdminHandler(r gin.IRouter)
+}
+
+func createAdminServer(cfg Config, svcs []Service, logger logrus.FieldLogger, ready func() bool) *http.Server {
+	if cfg.AdminPort == 0 && cfg.AdminSocket == "" {
+		return nil
+	}
+
+	return &http.Server{
+		Handler:        adminHandler(cfg, svcs, logger, ready),
+		Addr:           fmt.Sprintf(":%d", cfg.AdminPort),
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		ReadTimeout:    cfg.AdminReadTimeout,
+		WriteTimeout:   cfg.AdminWriteTimeout,
+		IdleTimeout:    cfg.AdminIdleTimeout,
+	}
+}
+
+func adminHandler(cfg Config, svcs []Service, logger logrus.FieldLogger, ready func() bool) http.Handler {
+	handler := gin.New()
+	handler.Use(gin.Recovery())
+	handler.NoRoute(extensions.NotFoundHandler)
+
+	handler.GET(HealthPath, healthHandler)
+	handler.GET(ReadinessPath, readinessHandler(ready))
+	handler.GET(MetricsPath, gin.WrapH(promhttp.Handler()))
+
+	if l, ok := logger.(*logrus.Logger); ok {
+		handler.GET(LogLevelPath, getLogLevelHandler(l))
+		handler.PUT(LogLevelPath, setLogLevelHandler(l))
+	}
+
+	if cfg.EnablePProf {
+		pprof.Register(handler)
+	}
+
+	for _, svc := range svcs {
+		if admin, ok := svc.(AdminService); ok {
+			admin.AdminHandler(handler)
+		}
+	}
+
+	return handler
+}
+
+func healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+func readinessHandler(ready func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status": "unavailable",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+		})
+	}
+}
+
+func getLogLevelHandler(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"level": logger.GetLevel().String(),
+		})
+	}
+}
+
+func setLogLevelHandler(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			extensions.AbortWithStatusJSON(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		level, err := logrus.ParseLevel(strings.ToLower(body.Level))
+		if err != nil {
+			extensions.AbortWithStatusJSON(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.SetLevel(level)
+		c.JSON(http.StatusOK, gin.H{
+			"level": level.String(),
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package kit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unixClient returns an HTTP client sending every request to the unix socket.
+func unixClient(socket string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+}
+
+func TestAdmin(t *testing.T) {
+	svc := newTestService("")
+	svc.cfg.AdminSocket = filepath.Join(t.TempDir(), "admin.sock")
+	svc.cfg.EnablePProf = true
+
+	s := New(svc)
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	admin := unixClient(svc.cfg.AdminSocket)
+	public := "http://127.0.0.1:" + strconv.Itoa(s.HTTPAddr().(*net.TCPAddr).Port)
+	get := func(c *http.Client, url string) int {
+		resp, err := c.Get(url)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	testCases := map[string]struct {
+		Path   string
+		Admin  int
+		Public int
+	}{
+		"health":    {HealthPath, http.StatusOK, http.StatusNotFound},
+		"readiness": {ReadinessPath, http.StatusOK, http.StatusNotFound},
+		"metrics":   {MetricsPath, http.StatusOK, http.StatusNotFound},
+		"log level": {LogLevelPath, http.StatusOK, http.StatusNotFound},
+		"pprof":     {"/debug/pprof/", http.StatusOK, http.StatusNotFound},
+		"service":   {"/ping", http.StatusNotFound, http.StatusOK},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			assert.Equal(t, tc.Admin, get(admin, "http://admin"+tc.Path))
+			assert.Equal(t, tc.Public, get(http.DefaultClient, public+tc.Path))
+		})
+	}
+
+	t.Run("set log level", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "http://admin"+LogLevelPath, strings.NewReader(`{"level": "debug"}`))
+		resp, err := admin.Do(req)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+}
+
+func TestAdminDuringShutdown(t *testing.T) {
+	svc := newTestService("")
+	svc.cfg.AdminSocket = filepath.Join(t.TempDir(), "admin.sock")
+
+	s := New(svc)
+	admin := unixClient(svc.cfg.AdminSocket)
+	get := func(path string) int {
+		resp, err := admin.Get("http://admin" + path)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the admin listener keeps answering until the last phase: probes see the
+	// server alive but not ready while it drains.
+	statuses := map[ShutdownPhase][2]int{}
+	for _, phase := range []ShutdownPhase{PhasePreDrain, PhaseDrain, PhaseClose} {
+		phase := phase
+		s.OnShutdown(phase, "probe", func(ctx context.Context) error {
+			statuses[phase] = [2]int{get(HealthPath), get(ReadinessPath)}
+			return nil
+		})
+	}
+
+	assert.NoError(t, s.Start())
+	assert.Equal(t, http.StatusOK, get(ReadinessPath))
+	assert.NoError(t, s.Stop())
+
+	for _, phase := range []ShutdownPhase{PhasePreDrain, PhaseDrain, PhaseClose} {
+		assert.Equal(t, [2]int{http.StatusOK, http.StatusServiceUnavailable}, statuses[phase], phase.String())
+	}
+
+	_, err := admin.Get("http://admin" + HealthPath)
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned when calls are rejected by an open circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of a circuit breaker.
+type State int
+
+// Circuit breaker states.
+const (
+	// StateClosed lets calls through.
+	StateClosed State = iota
+
+	// StateOpen rejects calls until the cooldown elapses.
+	StateOpen
+
+	// StateHalfOpen lets a single trial call through: the circuit closes when
+	// it succeeds and opens again when it fails.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// Breaker is a circuit breaker opening after consecutive failures.
+type Breaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	count    int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewBreaker creates a Breaker opening after the given number of consecutive
+// failures, for cooldown. It returns nil, a breaker letting every call
+// through, when failures is 0.
+func NewBreaker(failures int, cooldown time.Duration) *Breaker {
+	if failures <= 0 {
+		return nil
+	}
+
+	return &Breaker{
+		failures: failures,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a call may proceed, or returns ErrCircuitOpen. Allowed
+// calls must report their outcome with Done.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.trial = true
+		return nil
+
+	case StateHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+// Done records the outcome of an allowed call.
+func (b *Breaker) Done(success bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = StateClosed
+		b.count = 0
+		b.trial = false
+		return
+	}
+
+	b.count++
+	if b.state == StateHalfOpen || b.count >= b.failures {
+		b.state = StateOpen
+		b.openedAt = b.now()
+		b.trial = false
+	}
+}
+
+// Release ends an allowed call without recording its outcome, eg. when the
+// caller gave up: a trial call of a half-open breaker can be attempted again.
+func (b *Breaker) Release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
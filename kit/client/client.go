@@ -0,0 +1,100 @@
+/*
+Package client builds resilient outbound HTTP and gRPC clients.
+
+Clients created by NewHTTPClient and Dial bound every attempt with a timeout,
+retry idempotent calls with jittered exponential backoff, stop calling a
+failing upstream with a circuit breaker, forward the request ID and trace
+context of the call context (see the correlation package) and record
+Prometheus metrics, exposed by the kit admin server.
+
+Clients are configured by Config, usually loaded as part of kit.Config.
+*/
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Config configures the outbound clients.
+type Config struct {
+	// Timeout bounds each attempt of a call. There is no timeout when 0.
+	Timeout time.Duration `json:"timeout"`
+
+	// MaxRetries is the number of times failed idempotent calls are retried.
+	// Calls are not retried when 0.
+	MaxRetries int `json:"max_retries"`
+
+	// RetryBackoff is the base delay between retries, doubled at every
+	// attempt. Delays are drawn at random up to the computed value.
+	RetryBackoff time.Duration `json:"retry_backoff"`
+
+	// RetryMaxBackoff caps the delay between retries.
+	RetryMaxBackoff time.Duration `json:"retry_max_backoff"`
+
+	// BreakerFailures is the number of consecutive failures opening the
+	// circuit breaker. The breaker is disabled when 0.
+	BreakerFailures int `json:"breaker_failures"`
+
+	// BreakerCooldown is how long the circuit stays open before a trial call
+	// is let through.
+	BreakerCooldown time.Duration `json:"breaker_cooldown"`
+
+	// IdempotentRPCs lists the gRPC methods that may be retried, by full
+	// method name (eg. /api.GithubProxy/GetUser). HTTP calls are retried
+	// according to their method, see NewHTTPClient.
+	IdempotentRPCs []string `json:"idempotent_rpcs"`
+}
+
+// DefaultConfig returns a generic client configuration.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:         10 * time.Second,
+		MaxRetries:      2,
+		RetryBackoff:    100 * time.Millisecond,
+		RetryMaxBackoff: 2 * time.Second,
+		BreakerFailures: 5,
+		BreakerCooldown: 30 * time.Second,
+	}
+}
+
+// backoff returns the delay before the given retry, starting at 1, using
+// "full jitter": a random duration up to the exponential backoff.
+func (cfg Config) backoff(retry int) time.Duration {
+	d := cfg.RetryBackoff
+	if d <= 0 {
+		return 0
+	}
+
+	for i := 1; i < retry && (cfg.RetryMaxBackoff <= 0 || d < cfg.RetryMaxBackoff); i++ {
+		d *= 2
+	}
+	if cfg.RetryMaxBackoff > 0 && d > cfg.RetryMaxBackoff {
+		d = cfg.RetryMaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// sleep waits for the backoff of the given retry, or until ctx is done.
+func (cfg Config) sleep(ctx context.Context, retry int) error {
+	t := time.NewTimer(cfg.backoff(retry))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withTimeout bounds an attempt with the configured timeout.
+func (cfg Config) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, cfg.Timeout)
+}
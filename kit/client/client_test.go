@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testConfig() Config {
+	return Config{
+		Timeout:         time.Second,
+		MaxRetries:      2,
+		RetryBackoff:    time.Millisecond,
+		RetryMaxBackoff: 5 * time.Millisecond,
+		BreakerFailures: 3,
+		BreakerCooldown: time.Minute,
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{RetryBackoff: 100 * time.Millisecond, RetryMaxBackoff: 300 * time.Millisecond}
+
+	for retry := 1; retry <= 5; retry++ {
+		d := cfg.backoff(retry)
+		assert.True(t, d >= 0 && d <= 300*time.Millisecond, "retry %d: %v", retry, d)
+	}
+	assert.True(t, cfg.backoff(1) <= 100*time.Millisecond)
+	assert.Equal(t, time.Duration(0), Config{}.backoff(3))
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.NoError(t, b.Allow())
+	b.Done(false)
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.NoError(t, b.Allow())
+	b.Done(false)
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+
+	// a single trial call is let through after the cooldown.
+	now = now.Add(time.Minute)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+	b.Done(false)
+	assert.Equal(t, StateOpen, b.State())
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	b.Done(true)
+	assert.Equal(t, StateClosed, b.State())
+
+	// calls released without outcome free the trial.
+	now = now.Add(time.Minute)
+	b.Done(false)
+	b.Done(false)
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	b.Release()
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.NoError(t, b.Allow())
+
+	// disabled breakers let every call through.
+	assert.Nil(t, NewBreaker(0, time.Minute))
+	var disabled *Breaker
+	assert.NoError(t, disabled.Allow())
+	disabled.Done(false)
+	assert.Equal(t, StateClosed, disabled.State())
+}
+
+func TestHTTPClient(t *testing.T) {
+	var calls int32
+	var requestID atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID.Store(r.Header.Get(correlation.RequestIDHeader))
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testCases := map[string]struct {
+		Method string
+		Body   bool
+		Key    string
+		Status int
+		Calls  int32
+	}{
+		"get is retried":          {http.MethodGet, false, "", http.StatusOK, 3},
+		"put is retried":          {http.MethodPut, true, "", http.StatusOK, 3},
+		"post is not retried":     {http.MethodPost, true, "", http.StatusServiceUnavailable, 1},
+		"idempotency key retried": {http.MethodPost, true, "abc", http.StatusOK, 3},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			c := NewHTTPClient("test", Config{MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+			req, _ := http.NewRequest(tc.Method, server.URL, nil)
+			if tc.Body {
+				req, _ = http.NewRequest(tc.Method, server.URL, strings.NewReader("{}"))
+			}
+			if tc.Key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tc.Key)
+			}
+			req = req.WithContext(correlation.WithRequestID(context.Background(), "req-1"))
+
+			resp, err := c.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tc.Status, resp.StatusCode)
+			assert.Equal(t, tc.Calls, atomic.LoadInt32(&calls))
+			assert.Equal(t, "req-1", requestID.Load())
+		})
+	}
+}
+
+func TestHTTPClientBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	transport := NewTransport("test", testConfig(), nil)
+	c := &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, StateOpen, transport.Breaker().State())
+
+	_, err := c.Get(server.URL)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ErrCircuitOpen.Error())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestHTTPClientCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.BreakerFailures = 1
+	transport := NewTransport("test", cfg, nil)
+	c := &http.Client{Transport: transport}
+
+	// callers giving up do not open the breaker.
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		_, err := c.Do(req.WithContext(ctx))
+		cancel()
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), ErrCircuitOpen.Error())
+	}
+	assert.Equal(t, StateClosed, transport.Breaker().State())
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	c := NewHTTPClient("test", Config{Timeout: 10 * time.Millisecond})
+	_, err := c.Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	testCases := map[string]struct {
+		Idempotent bool
+		Errors     []codes.Code
+		Code       codes.Code
+		Calls      int
+	}{
+		"success":             {true, []codes.Code{codes.OK}, codes.OK, 1},
+		"retried":             {true, []codes.Code{codes.Unavailable, codes.Unavailable, codes.OK}, codes.OK, 3},
+		"retries exhausted":   {true, []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}, codes.Unavailable, 3},
+		"not idempotent":      {false, []codes.Code{codes.Unavailable, codes.OK}, codes.Unavailable, 1},
+		"permanent error":     {true, []codes.Code{codes.InvalidArgument, codes.OK}, codes.InvalidArgument, 1},
+		"deadline is retried": {true, []codes.Code{codes.DeadlineExceeded, codes.OK}, codes.OK, 2},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BreakerFailures = 0
+			if tc.Idempotent {
+				cfg.IdempotentRPCs = []string{"/api.Test/Get"}
+			}
+
+			calls := 0
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				_, ok := ctx.Deadline()
+				assert.True(t, ok)
+				code := tc.Errors[calls]
+				calls++
+				return status.Error(code, code.String())
+			}
+
+			err := UnaryClientInterceptor("test", cfg, nil)(context.Background(), "/api.Test/Get", nil, nil, nil, invoker)
+			assert.Equal(t, tc.Code, status.Code(err))
+			assert.Equal(t, tc.Calls, calls)
+		})
+	}
+}
+
+func TestUnaryClientInterceptorBreaker(t *testing.T) {
+	cfg := testConfig()
+	breaker := NewBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+	interceptor := UnaryClientInterceptor("test", cfg, breaker)
+
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.Internal, "boom")
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, codes.Internal, status.Code(interceptor(context.Background(), "/api.Test/Get", nil, nil, nil, invoker)))
+	}
+
+	err := interceptor(context.Background(), "/api.Test/Get", nil, nil, nil, invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Dial creates a grpc.ClientConn to target using the client interceptors. The
+// name labels the client metrics.
+func Dial(ctx context.Context, target, name string, cfg Config, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	breaker := NewBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+
+	opts = append([]grpc.DialOption{
+		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
+			correlation.UnaryClientInterceptor(),
+			UnaryClientInterceptor(name, cfg, breaker),
+		)),
+		grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
+			correlation.StreamClientInterceptor(),
+			StreamClientInterceptor(name, breaker),
+		)),
+	}, opts...)
+
+	return grpc.DialContext(ctx, target, opts...)
+}
+
+// UnaryClientInterceptor returns a grpc.UnaryClientInterceptor bounding each
+// attempt with the configured timeout and retrying the IdempotentRPCs failing
+// with Unavailable, ResourceExhausted, Aborted or DeadlineExceeded. Codes
+// reporting a server failure count as failures for the breaker, which may be nil.
+func UnaryClientInterceptor(name string, cfg Config, breaker *Breaker) grpc.UnaryClientInterceptor {
+	idempotent := map[string]bool{}
+	for _, method := range cfg.IdempotentRPCs {
+		idempotent[method] = true
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		retries := 0
+		if idempotent[method] {
+			retries = cfg.MaxRetries
+		}
+
+		for attempt := 0; ; attempt++ {
+			if attempt > 0 {
+				if err := cfg.sleep(ctx, attempt); err != nil {
+					return contextError(err)
+				}
+				retriesTotal.WithLabelValues(name, method).Inc()
+			}
+
+			err := invokeAttempt(ctx, name, cfg, breaker, method, req, reply, cc, invoker, opts...)
+			if attempt >= retries || err == nil || ctx.Err() != nil || !temporaryCode(status.Code(err)) || breaker.State() == StateOpen {
+				return err
+			}
+		}
+	}
+}
+
+func invokeAttempt(ctx context.Context, name string, cfg Config, breaker *Breaker, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if err := breaker.Allow(); err != nil {
+		breakerRejectedTotal.WithLabelValues(name).Inc()
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	attemptCtx, cancel := cfg.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	err := invoker(attemptCtx, method, req, reply, cc, opts...)
+	code := status.Code(err)
+	observe(name, method, code.String(), start)
+	done(ctx, breaker, code)
+
+	return err
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor rejecting
+// streams while the breaker, which may be nil, is open. Streams are neither
+// bounded nor retried.
+func StreamClientInterceptor(name string, breaker *Breaker) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := breaker.Allow(); err != nil {
+			breakerRejectedTotal.WithLabelValues(name).Inc()
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		code := status.Code(err)
+		observe(name, method, code.String(), start)
+		done(ctx, breaker, code)
+
+		return stream, err
+	}
+}
+
+// done records the outcome of a call, unless the caller gave up.
+func done(ctx context.Context, breaker *Breaker, code codes.Code) {
+	if ctx.Err() != nil {
+		breaker.Release()
+		return
+	}
+	breaker.Done(!serverFailure(code))
+}
+
+func contextError(err error) error {
+	if err == context.DeadlineExceeded {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Canceled, err.Error())
+}
+
+func temporaryCode(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+func serverFailure(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/insighted4/insighted-go/kit/correlation"
+)
+
+// IdempotencyKeyHeader marks requests that may be retried whatever their method.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// NewHTTPClient creates an http.Client using a Transport named after the
+// upstream service, eg. "github". The name labels the client metrics.
+func NewHTTPClient(name string, cfg Config) *http.Client {
+	return &http.Client{
+		Transport: NewTransport(name, cfg, nil),
+	}
+}
+
+// Transport is an http.RoundTripper bounding, retrying and circuit breaking
+// requests. Requests are retried on network errors and on 429, 502, 503 and
+// 504 responses when idempotent: GET, HEAD, OPTIONS, PUT and DELETE requests,
+// or requests carrying an Idempotency-Key header, whose body can be replayed.
+// Responses with a 5xx status count as failures for the circuit breaker.
+type Transport struct {
+	name    string
+	cfg     Config
+	base    http.RoundTripper
+	breaker *Breaker
+}
+
+// NewTransport creates a Transport sending requests with base, forwarding the
+// request ID and the trace context of the request context. The base defaults
+// to http.DefaultTransport.
+func NewTransport(name string, cfg Config, base http.RoundTripper) *Transport {
+	return &Transport{
+		name:    name,
+		cfg:     cfg,
+		base:    &correlation.Transport{Base: base},
+		breaker: NewBreaker(cfg.BreakerFailures, cfg.BreakerCooldown),
+	}
+}
+
+// Breaker returns the circuit breaker of the transport, nil when disabled.
+func (t *Transport) Breaker() *Breaker {
+	return t.breaker
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if retryable(req) {
+		retries = t.cfg.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := t.cfg.sleep(req.Context(), attempt); err != nil {
+				return nil, err
+			}
+			retriesTotal.WithLabelValues(t.name, req.Method).Inc()
+
+			// RoundTrippers must not modify the request.
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req = req.Clone(req.Context())
+				req.Body = body
+			}
+		}
+
+		resp, err := t.attempt(req)
+		if attempt >= retries || err == ErrCircuitOpen || req.Context().Err() != nil || !temporary(resp, err) {
+			return resp, err
+		}
+
+		if resp != nil {
+			// drain the body so the connection is reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+	}
+}
+
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		breakerRejectedTotal.WithLabelValues(t.name).Inc()
+		return nil, err
+	}
+
+	ctx, cancel := t.cfg.withTimeout(req.Context())
+	start := time.Now()
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		observe(t.name, req.Method, "error", start)
+		if req.Context().Err() != nil {
+			// the caller gave up: it says nothing about the server.
+			t.breaker.Release()
+		} else {
+			t.breaker.Done(false)
+		}
+		return nil, err
+	}
+
+	observe(t.name, req.Method, strconv.Itoa(resp.StatusCode), start)
+	t.breaker.Done(resp.StatusCode < http.StatusInternalServerError)
+
+	// the attempt context bounds the body too: cancel it once read.
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return req.Header.Get(IdempotencyKeyHeader) != ""
+	}
+}
+
+func temporary(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
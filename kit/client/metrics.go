@@ -0,0 +1,47 @@
+package client
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kit",
+		Subsystem: "client",
+		Name:      "requests_total",
+		Help:      "Outbound call attempts by client, method and result code.",
+	}, []string{"client", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kit",
+		Subsystem: "client",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the outbound call attempts by client and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"client", "method"})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kit",
+		Subsystem: "client",
+		Name:      "retries_total",
+		Help:      "Retried outbound calls by client and method.",
+	}, []string{"client", "method"})
+
+	breakerRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kit",
+		Subsystem: "client",
+		Name:      "breaker_rejected_total",
+		Help:      "Outbound calls rejected by an open circuit breaker, by client.",
+	}, []string{"client"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, retriesTotal, breakerRejectedTotal)
+}
+
+func observe(client, method, code string, start time.Time) {
+	requestsTotal.WithLabelValues(client, method, code).Inc()
+	requestDuration.WithLabelValues(client, method).Observe(time.Since(start).Seconds())
+}
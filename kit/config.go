@@ -1,7 +1,11 @@
 package kit
 
 import (
+	"os"
 	"time"
+
+	"github.com/insighted4/insighted-go/kit/client"
+	"github.com/insighted4/insighted-go/kit/extensions"
 )
 
 // Config holds info required to configure a server.Server.
@@ -25,36 +29,203 @@ type Config struct {
 	// of 5m.
 	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
 
+	// ShutdownDelay is how long the server waits, once readiness is turned off,
+	// before draining the listeners so load balancers notice it is going away.
+	// The default is 0.
+	ShutdownDelay time.Duration `json:"shutdown_delay"`
+
+	// WorkerBackoff is the initial delay before restarting a failed worker.
+	// It doubles on each consecutive failure. The default is 1s.
+	WorkerBackoff time.Duration `json:"worker_backoff"`
+
+	// WorkerMaxBackoff caps the delay before restarting a failed worker. The default is 1m.
+	WorkerMaxBackoff time.Duration `json:"worker_max_backoff"`
+
 	// HTTPPort is the port the server implementation will serve HTTP over.
 	// The default is 8080
 	HTTPPort int `json:"http_port"`
 
+	// PathPrefix mounts the HTTP handler of the service under the given path,
+	// with the prefix stripped from requests. It allows several services hosted
+	// by RunContext to share the same HTTPPort. The default is no prefix.
+	PathPrefix string `json:"path_prefix"`
+
 	// RPCPort is the port the server implementation will serve RPC over.
 	// The default is 8081.
 	RPCPort int `json:"rpc_port"`
 
+	// RPCTimeout bounds the duration of unary RPCs. Calls without a deadline,
+	// or with a longer one, get this timeout applied. The default of 0 leaves
+	// the deadline to the callers; services opt in by setting it, eg. to 30s.
+	RPCTimeout time.Duration `json:"rpc_timeout"`
+
+	// RPCStreamTimeout bounds the duration of streaming RPCs the same way
+	// RPCTimeout does for unary ones. The default of 0 leaves streams unbounded.
+	RPCStreamTimeout time.Duration `json:"rpc_stream_timeout"`
+
+	// DisableRPCDefaultInterceptors removes the default gRPC interceptor stack
+	// (request ID, tracing, access logging, error mapping, panic recovery and deadline enforcement).
+	DisableRPCDefaultInterceptors bool `json:"disable_rpc_default_interceptors"`
+
+	// HTTPSocket is the path of a unix domain socket to serve HTTP over,
+	// instead of HTTPPort. Empty by default.
+	HTTPSocket string `json:"http_socket"`
+
+	// RPCSocket is the path of a unix domain socket to serve RPC over,
+	// instead of RPCPort. Empty by default.
+	RPCSocket string `json:"rpc_socket"`
+
+	// AdminSocket is the path of a unix domain socket to serve the admin
+	// endpoints over, instead of AdminPort. Empty by default.
+	AdminSocket string `json:"admin_socket"`
+
+	// SocketMode is the file permissions of the unix domain sockets. The default is 0660.
+	SocketMode os.FileMode `json:"socket_mode"`
+
+	// SinglePort serves both HTTP and RPC over HTTPPort, routing gRPC requests
+	// (HTTP/2 with an application/grpc content type) to the gRPC server and
+	// everything else to the HTTP handler. RPCPort is ignored when set.
+	// Note that ReadTimeout and WriteTimeout also bound gRPC streams in this mode.
+	SinglePort bool `json:"single_port"`
+
+	// AdminPort is the port the server implementation will serve operational
+	// endpoints (pprof, metrics, health and log level) over. These endpoints are
+	// not authenticated, so the admin listener is disabled by default (0): set
+	// a port, eg. 8082, reachable only from the internal network, or use
+	// AdminSocket.
+	AdminPort int `json:"admin_port"`
+
+	// AdminReadTimeout can be used to override the default admin server read timeout of 5s.
+	AdminReadTimeout time.Duration `json:"admin_read_timeout"`
+
+	// AdminWriteTimeout can be used to override the default admin server write timeout of 60s.
+	// It must be longer than the pprof profiling window (30s by default).
+	AdminWriteTimeout time.Duration `json:"admin_write_timeout"`
+
+	// AdminIdleTimeout can be used to override the default admin server idle timeout of 120s.
+	AdminIdleTimeout time.Duration `json:"admin_idle_timeout"`
+
+	// ListenerHandoff enables zero-downtime restarts: on SIGUSR2 the server
+	// re-executes its binary, passing the listeners to the new process, and
+	// drains. Listeners inherited through systemd socket activation are always
+	// used when their port matches. Off by default; not supported on Windows.
+	ListenerHandoff bool `json:"listener_handoff"`
+
+	// TLSCertFile is the PEM encoded certificate served by the HTTP and RPC listeners.
+	// TLS is enabled when both TLSCertFile and TLSKeyFile are set.
+	TLSCertFile string `json:"tls_cert_file"`
+
+	// TLSKeyFile is the PEM encoded private key matching TLSCertFile.
+	TLSKeyFile string `json:"tls_key_file"`
+
+	// TLSClientCAFile is a PEM bundle of CAs used to verify client certificates.
+	// Setting it enables mutual TLS: clients must present a certificate signed by one of these CAs.
+	TLSClientCAFile string `json:"tls_client_ca_file"`
+
+	// TLSReloadInterval is how often the TLS files are checked for changes on disk.
+	// The default is 10s.
+	TLSReloadInterval time.Duration `json:"tls_reload_interval"`
+
+	// TraceExporter selects where the OpenTelemetry spans are exported: "stdout",
+	// "file" (JSON lines written to TraceFile) or "memory" (see Server.Spans).
+	// Each server has its own tracer provider, see Server.TracerProvider; the
+	// global OpenTelemetry provider is left untouched. Tracing is disabled when
+	// empty, the default.
+	TraceExporter string `json:"trace_exporter"`
+
+	// TraceFile is the file spans are appended to by the "file" exporter.
+	TraceFile string `json:"trace_file"`
+
+	// TraceSampleRatio is the fraction of new traces that are sampled. Requests
+	// continuing a trace follow the sampling decision of the caller. The default is 1.
+	TraceSampleRatio float64 `json:"trace_sample_ratio"`
+
+	// CORS is the Cross-Origin Resource Sharing policy of the HTTP handlers using
+	// extensions.CORSPolicyHandler. No origin is allowed by default.
+	CORS extensions.CORSPolicy `json:"cors"`
+
+	// Client configures the outbound HTTP and gRPC clients created with the
+	// client package: timeouts, retries and circuit breaking.
+	Client client.Config `json:"client"`
+
+	// EnableOpenAPI serves the OpenAPI document of the services at OpenAPIPath
+	// and a page rendering it at DocsPath, on the HTTP listener. Off by default.
+	EnableOpenAPI bool `json:"enable_openapi"`
+
+	// OpenAPITitle is the title of the OpenAPI document. The default is "API".
+	OpenAPITitle string `json:"openapi_title"`
+
+	// OpenAPIVersion is the version of the API in the OpenAPI document. The default is "1.0.0".
+	OpenAPIVersion string `json:"openapi_version"`
+
+	// GatewayMaxBodyBytes bounds the request bodies read by the routes of
+	// RegisterGateway. Larger ones are rejected with 413 Request Entity Too
+	// Large. The default is 4MiB, the default message size limit of gRPC.
+	GatewayMaxBodyBytes int64 `json:"gateway_max_body_bytes"`
+
+	// GatewayHeaders are the HTTP headers, matched case insensitively, the
+	// routes of RegisterGateway forward as gRPC metadata, in addition to the
+	// headers prefixed with Grpc-Metadata-. The default is DefaultGatewayHeaders.
+	GatewayHeaders []string `json:"gateway_headers"`
+
 	// Enable pprof Profiling. Off by default.
 	EnablePProf bool `json:"enable_pprof"`
 
 	// LoggerHandler level (eg.: panic, fatal, error, warn, info, debug)
 	LoggerLevel string `json:"logger_level"`
 
-	// LoggerHandler format (ex.: text, json)
+	// LoggerHandler format (ex.: text, json, gcp). gcp formats entries for Google Cloud Logging.
 	LoggerFormat string `json:"logger_format"`
+
+	// LoggerRedactFields are the names of the fields, matched case insensitively,
+	// whose values are replaced with [REDACTED]. The default is DefaultRedactedFields.
+	LoggerRedactFields []string `json:"logger_redact_fields"`
+
+	// LoggerRedactPatterns are the regular expressions whose matches in messages
+	// and field values, including nested ones, are replaced with [REDACTED].
+	// The default is DefaultRedactedPatterns: Authorization credentials,
+	// credential query parameters and email addresses.
+	LoggerRedactPatterns []string `json:"logger_redact_patterns"`
+
+	// LoggerSampleLevel is the most severe level sampled (eg.: info, debug).
+	// The default is info: warnings and errors are always logged.
+	LoggerSampleLevel string `json:"logger_sample_level"`
+
+	// LoggerSampleFirst is the number of entries with the same level and message
+	// logged every second before sampling starts. Sampling is disabled when 0, the default.
+	LoggerSampleFirst int `json:"logger_sample_first"`
+
+	// LoggerSampleThereafter logs every nth entry once sampling started. All
+	// further entries within the second are dropped when 0.
+	LoggerSampleThereafter int `json:"logger_sample_thereafter"`
 }
 
 // DefaultConfig returns a generic server configuration.
 func DefaultConfig() Config {
 	return Config{
-		MaxHeaderBytes:  1 << 20,
-		ReadTimeout:     20 * time.Second,
-		WriteTimeout:    20 * time.Second,
-		IdleTimeout:     120 * time.Second,
-		ShutdownTimeout: 5 * time.Minute,
-		HTTPPort:        8080,
-		RPCPort:         8081,
-		EnablePProf:     false,
-		LoggerLevel:     "info",
-		LoggerFormat:    "json",
+		MaxHeaderBytes:       1 << 20,
+		ReadTimeout:          20 * time.Second,
+		WriteTimeout:         20 * time.Second,
+		IdleTimeout:          120 * time.Second,
+		ShutdownTimeout:      5 * time.Minute,
+		WorkerBackoff:        time.Second,
+		WorkerMaxBackoff:     time.Minute,
+		HTTPPort:             8080,
+		RPCPort:              8081,
+		AdminReadTimeout:     5 * time.Second,
+		AdminWriteTimeout:    60 * time.Second,
+		AdminIdleTimeout:     120 * time.Second,
+		TLSReloadInterval:    10 * time.Second,
+		TraceSampleRatio:     1,
+		GatewayMaxBodyBytes:  defaultGatewayMaxBodyBytes,
+		GatewayHeaders:       DefaultGatewayHeaders,
+		Client:               client.DefaultConfig(),
+		SocketMode:           0660,
+		EnablePProf:          false,
+		LoggerLevel:          "info",
+		LoggerFormat:         "json",
+		LoggerRedactFields:   DefaultRedactedFields,
+		LoggerRedactPatterns: DefaultRedactedPatterns,
+		LoggerSampleLevel:    "info",
 	}
 }
@@ -0,0 +1,16 @@
+package kit
+
+import (
+	"testing"
+
+	"github.com/insighted4/insighted-go/kit/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	cfg := DefaultConfig()
+
+	// outbound calls are bounded by default.
+	assert.Equal(t, client.DefaultConfig(), cfg.Client)
+	assert.NotZero(t, cfg.Client.Timeout)
+}
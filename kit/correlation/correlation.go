@@ -0,0 +1,217 @@
+/*
+Package correlation carries the request ID and the W3C trace context
+(https://www.w3.org/TR/trace-context/) of a request through context.Context,
+HTTP headers and gRPC metadata.
+
+The kit middleware and interceptors store them in the request context; outbound
+clients forward them with Transport and the client interceptors, and libraries
+such as eventsourcing read them back with RequestID, TraceParentFromContext and
+Fields. The package does not depend on the rest of kit.
+*/
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RequestIDHeader is the HTTP header carrying the request ID.
+	RequestIDHeader = "X-Request-Id"
+
+	// TraceParentHeader is the HTTP header carrying the W3C trace context.
+	TraceParentHeader = "Traceparent"
+
+	// RequestIDMetadataKey is the gRPC metadata key carrying the request ID.
+	RequestIDMetadataKey = "x-request-id"
+
+	// TraceParentMetadataKey is the gRPC metadata key carrying the W3C trace context.
+	TraceParentMetadataKey = "traceparent"
+)
+
+// Log fields set by Fields.
+const (
+	RequestIDField    = "x-request-id"
+	TraceIDField      = "trace-id"
+	SpanIDField       = "span-id"
+	TraceSampledField = "trace-sampled"
+)
+
+type requestIDKey struct{}
+
+type traceParentKey struct{}
+
+type loggerKey struct{}
+
+// NewRequestID generates a request ID.
+func NewRequestID() string {
+	return uuid.Must(uuid.NewV4()).String()
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// TraceParent is a W3C traceparent: the trace a request belongs to and the
+// span, within that trace, of the current operation.
+type TraceParent struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// NewTraceParent starts a new sampled trace.
+func NewTraceParent() TraceParent {
+	var tp TraceParent
+	rand.Read(tp.TraceID[:])
+	rand.Read(tp.SpanID[:])
+	tp.Flags = 0x01
+	return tp
+}
+
+// ParseTraceParent parses a traceparent header value, eg.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func ParseTraceParent(s string) (TraceParent, error) {
+	var tp TraceParent
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tp, errors.Errorf("invalid traceparent %q", s)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return tp, errors.Errorf("invalid traceparent %q", s)
+	}
+
+	var flags [1]byte
+	if err := decodeHex(tp.TraceID[:], parts[1]); err != nil {
+		return tp, errors.Wrapf(err, "invalid traceparent %q", s)
+	}
+	if err := decodeHex(tp.SpanID[:], parts[2]); err != nil {
+		return tp, errors.Wrapf(err, "invalid traceparent %q", s)
+	}
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return tp, errors.Wrapf(err, "invalid traceparent %q", s)
+	}
+	tp.Flags = flags[0]
+
+	if !tp.IsValid() {
+		return tp, errors.Errorf("invalid traceparent %q", s)
+	}
+
+	return tp, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errors.Errorf("expected %d lowercase hex digits", hex.EncodedLen(len(dst)))
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// IsValid reports whether the trace and span IDs are set, as required by the specification.
+func (tp TraceParent) IsValid() bool {
+	return tp.TraceID != [16]byte{} && tp.SpanID != [8]byte{}
+}
+
+// Sampled reports whether the caller may have recorded the trace.
+func (tp TraceParent) Sampled() bool {
+	return tp.Flags&0x01 != 0
+}
+
+// Child returns the traceparent of an operation within the same trace, with a new span ID.
+func (tp TraceParent) Child() TraceParent {
+	rand.Read(tp.SpanID[:])
+	return tp
+}
+
+// TraceIDString returns the hex representation of the trace ID.
+func (tp TraceParent) TraceIDString() string {
+	return hex.EncodeToString(tp.TraceID[:])
+}
+
+// SpanIDString returns the hex representation of the span ID.
+func (tp TraceParent) SpanIDString() string {
+	return hex.EncodeToString(tp.SpanID[:])
+}
+
+// String returns the traceparent header value.
+func (tp TraceParent) String() string {
+	return "00-" + tp.TraceIDString() + "-" + tp.SpanIDString() + "-" + hex.EncodeToString([]byte{tp.Flags})
+}
+
+// WithTraceParent returns a copy of ctx carrying the traceparent.
+func WithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, tp)
+}
+
+// TraceParentFromContext returns the traceparent carried by ctx.
+func TraceParentFromContext(ctx context.Context) (TraceParent, bool) {
+	tp, ok := ctx.Value(traceParentKey{}).(TraceParent)
+	return tp, ok
+}
+
+// Incoming returns a copy of ctx carrying the request ID and the trace context
+// of an incoming request, as read from its headers or metadata. A request ID is
+// generated when missing. The request continues the trace of the caller in a new
+// span, or starts a new trace when the traceparent is missing or invalid.
+func Incoming(ctx context.Context, requestID, traceParent string) context.Context {
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+
+	tp, err := ParseTraceParent(traceParent)
+	if err != nil {
+		tp = NewTraceParent()
+	} else {
+		tp = tp.Child()
+	}
+
+	return WithTraceParent(WithRequestID(ctx, requestID), tp)
+}
+
+// Fields returns the log fields identifying the request carried by ctx.
+func Fields(ctx context.Context) logrus.Fields {
+	fields := logrus.Fields{}
+	if id := RequestID(ctx); id != "" {
+		fields[RequestIDField] = id
+	}
+
+	if tp, ok := TraceParentFromContext(ctx); ok {
+		fields[TraceIDField] = tp.TraceIDString()
+		fields[SpanIDField] = tp.SpanIDString()
+		fields[TraceSampledField] = tp.Sampled()
+	}
+
+	return fields
+}
+
+// WithLogger returns a copy of ctx carrying the logger used by Logger.
+func WithLogger(ctx context.Context, logger logrus.FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns a request-scoped logger: the logger carried by ctx, or the
+// standard logger, with the request ID and trace fields of ctx.
+func Logger(ctx context.Context) logrus.FieldLogger {
+	logger, ok := ctx.Value(loggerKey{}).(logrus.FieldLogger)
+	if !ok {
+		logger = logrus.StandardLogger()
+	}
+
+	return logger.WithFields(Fields(ctx))
+}
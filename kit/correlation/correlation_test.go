@@ -0,0 +1,123 @@
+package correlation
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	testCases := map[string]struct {
+		Value string
+		Valid bool
+	}{
+		"valid":           {testTraceParent, true},
+		"not sampled":     {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		"future version":  {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		"empty":           {"", false},
+		"extra fields":    {testTraceParent + "-extra", false},
+		"invalid version": {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		"uppercase":       {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		"short trace id":  {"00-4bf92f3577b34da6-00f067aa0ba902b7-01", false},
+		"zero trace id":   {"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		"zero span id":    {"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		"non hex flags":   {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz", false},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			tp, err := ParseTraceParent(tc.Value)
+			if !tc.Valid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tp.TraceIDString())
+			assert.Equal(t, "00f067aa0ba902b7", tp.SpanIDString())
+		})
+	}
+
+	tp, _ := ParseTraceParent(testTraceParent)
+	assert.Equal(t, testTraceParent, tp.String())
+	assert.True(t, tp.Sampled())
+}
+
+func TestIncoming(t *testing.T) {
+	ctx := Incoming(context.Background(), "abc", testTraceParent)
+	assert.Equal(t, "abc", RequestID(ctx))
+
+	tp, ok := TraceParentFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tp.TraceIDString())
+	assert.NotEqual(t, "00f067aa0ba902b7", tp.SpanIDString())
+
+	ctx = Incoming(context.Background(), "", "invalid")
+	assert.NotEmpty(t, RequestID(ctx))
+
+	tp, ok = TraceParentFromContext(ctx)
+	assert.True(t, ok)
+	assert.True(t, tp.IsValid())
+}
+
+func TestLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.Out = ioutil.Discard
+
+	ctx := WithLogger(Incoming(context.Background(), "abc", testTraceParent), logger)
+	Logger(ctx).Info("hello")
+
+	entry := hook.LastEntry()
+	assert.Equal(t, "abc", entry.Data["x-request-id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry.Data["trace-id"])
+	assert.NotEmpty(t, entry.Data["span-id"])
+
+	assert.Equal(t, logrus.Fields{}, Fields(context.Background()))
+}
+
+func TestTransport(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	ctx := Incoming(context.Background(), "abc", testTraceParent)
+	tp, _ := TraceParentFromContext(ctx)
+
+	req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	assert.NoError(t, err)
+
+	res, err := client.Do(req.WithContext(ctx))
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, "abc", got.Get(RequestIDHeader))
+	assert.Equal(t, tp.String(), got.Get(TraceParentHeader))
+	assert.Empty(t, req.Header.Get(RequestIDHeader))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	ctx := Incoming(context.Background(), "abc", testTraceParent)
+	ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadataKey, "stale")
+	tp, _ := TraceParentFromContext(ctx)
+
+	err := UnaryClientInterceptor()(ctx, "/test.Service/Method", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"abc"}, md.Get(RequestIDMetadataKey))
+		assert.Equal(t, []string{tp.String()}, md.Get(TraceParentMetadataKey))
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,89 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// InjectHeader sets the request ID and traceparent headers from ctx.
+func InjectHeader(ctx context.Context, h http.Header) {
+	if id := RequestID(ctx); id != "" {
+		h.Set(RequestIDHeader, id)
+	}
+
+	if tp, ok := TraceParentFromContext(ctx); ok {
+		h.Set(TraceParentHeader, tp.String())
+	}
+}
+
+// Transport is an http.RoundTripper forwarding the request ID and the trace
+// context of the request context to the upstream server.
+type Transport struct {
+	// Base is the underlying RoundTripper. It defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	if RequestID(ctx) == "" {
+		if _, ok := TraceParentFromContext(ctx); !ok {
+			return base.RoundTrip(req)
+		}
+	}
+
+	// RoundTrippers must not modify the request.
+	req = req.Clone(ctx)
+	InjectHeader(ctx, req.Header)
+	return base.RoundTrip(req)
+}
+
+// outgoing returns a copy of ctx with the request ID and traceparent appended
+// to the outgoing metadata.
+func outgoing(ctx context.Context) context.Context {
+	var kv []string
+	if id := RequestID(ctx); id != "" {
+		kv = append(kv, RequestIDMetadataKey, id)
+	}
+
+	if tp, ok := TraceParentFromContext(ctx); ok {
+		kv = append(kv, TraceParentMetadataKey, tp.String())
+	}
+
+	if len(kv) == 0 {
+		return ctx
+	}
+
+	// drop values forwarded explicitly by the caller, eg. with the incoming metadata.
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = md.Copy()
+		md.Delete(RequestIDMetadataKey)
+		md.Delete(TraceParentMetadataKey)
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// UnaryClientInterceptor returns a grpc.UnaryClientInterceptor forwarding the
+// request ID and the trace context of the call context to the server.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of UnaryClientInterceptor.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
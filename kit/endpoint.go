@@ -0,0 +1,130 @@
+package kit
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/pkg/errors"
+)
+
+// endpointMethods are the methods answered with 405 Method Not Allowed when
+// an endpoint does not handle them.
+var endpointMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// EndpointHandler builds the gin engine serving the endpoints of the service,
+// with the standard middleware stack: panic recovery, the Config CORS policy,
+// access logging, request IDs, tracing (when TraceExporter is set) and problem
+// details rendering of errors. Unknown routes are answered with 404 Not Found.
+//
+// The Middleware of each endpoint runs before its handlers. HEAD requests are
+// served by the GET handler unless the endpoint handles HEAD, and methods the
+// endpoint does not handle are answered with 405 Method Not Allowed and the
+// Allow header.
+func EndpointHandler(svc EndpointService) (http.Handler, error) {
+	cfg := svc.Config()
+	logger, err := NewLoggerWithOptions(WithLoggerConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	cors, err := extensions.NewCORS(cfg.CORS)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := gin.New()
+	handler.Use(gin.Recovery())
+	handler.Use(extensions.CORSPolicyHandler(cors))
+	handler.Use(extensions.LoggerHandler(logger, time.RFC3339, true, LoggerHandlerOptions(cfg)...))
+	handler.Use(extensions.RequestIDHandler())
+	if cfg.TraceExporter != "" {
+		handler.Use(extensions.TracingHandler())
+	}
+	handler.Use(extensions.ErrorHandler())
+	handler.NoRoute(extensions.NotFoundHandler)
+
+	endpoints := svc.HTTPEndpoints()
+	paths := make([]string, 0, len(endpoints))
+	for p := range endpoints {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if err := registerEndpoint(handler, p, endpoints[p]); err != nil {
+			return nil, err
+		}
+	}
+
+	return handler, nil
+}
+
+// registerEndpoint registers the handlers of the endpoint, reporting the
+// invalid routes gin panics on as errors.
+func registerEndpoint(r gin.IRoutes, path string, e *HTTPEndpoint) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = errors.Errorf("invalid endpoint %s: %v", path, rec)
+		}
+	}()
+
+	if e == nil || len(e.Methods) == 0 {
+		return errors.Errorf("endpoint %s has no methods", path)
+	}
+
+	handlers := func(h gin.HandlerFunc) []gin.HandlerFunc {
+		if e.Middleware != nil {
+			return []gin.HandlerFunc{e.Middleware, h}
+		}
+		return []gin.HandlerFunc{h}
+	}
+
+	methods := map[string]gin.HandlerFunc{}
+	for method, h := range e.Methods {
+		if h == nil {
+			return errors.Errorf("endpoint %s has no handler for %s", path, method)
+		}
+		methods[strings.ToUpper(method)] = h
+	}
+	if _, ok := methods[http.MethodHead]; !ok && methods[http.MethodGet] != nil {
+		methods[http.MethodHead] = methods[http.MethodGet]
+	}
+
+	allowed := make([]string, 0, len(methods))
+	for method := range methods {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+
+	for _, method := range allowed {
+		r.Handle(method, path, handlers(methods[method])...)
+	}
+
+	notAllowed := methodNotAllowedHandler(strings.Join(allowed, ", "))
+	for _, method := range endpointMethods {
+		if _, ok := methods[method]; !ok {
+			r.Handle(method, path, notAllowed)
+		}
+	}
+
+	return nil
+}
+
+func methodNotAllowedHandler(allow string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Allow", allow)
+		extensions.AbortWithStatusJSON(c, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
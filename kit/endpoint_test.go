@@ -0,0 +1,111 @@
+package kit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/insighted4/insighted-go/kit/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type endpointTestService struct {
+	testService
+	endpoints map[string]*HTTPEndpoint
+}
+
+func (s endpointTestService) HTTPEndpoints() map[string]*HTTPEndpoint { return s.endpoints }
+
+func newEndpointTestService(prefix string) endpointTestService {
+	return endpointTestService{
+		testService: newTestService(prefix),
+		endpoints: map[string]*HTTPEndpoint{
+			"/users/:name": {
+				Middleware: func(c *gin.Context) {
+					c.Header("X-Endpoint", "users")
+				},
+				Methods: map[string]gin.HandlerFunc{
+					http.MethodGet: func(c *gin.Context) {
+						c.String(http.StatusOK, "user "+c.Param("name"))
+					},
+					http.MethodDelete: func(c *gin.Context) {
+						c.Status(http.StatusNoContent)
+					},
+				},
+				Docs: map[string]openapi.Route{
+					http.MethodGet: {Summary: "Get a user"},
+				},
+			},
+		},
+	}
+}
+
+func TestEndpointHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, err := httpHandler([]Service{newEndpointTestService("/a"), newTestService("/b")})
+	assert.NoError(t, err)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := do(http.MethodGet, "/a/users/jane")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user jane", w.Body.String())
+	assert.Equal(t, "users", w.Header().Get("X-Endpoint"))
+	assert.NotEmpty(t, w.Header().Get(correlation.RequestIDHeader))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodHead, "/a/users/jane").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/a/users/jane").Code)
+
+	w = do(http.MethodPost, "/a/users/jane")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD", w.Header().Get("Allow"))
+	assert.Equal(t, extensions.ProblemContentType, w.Header().Get("Content-Type"))
+
+	w = do(http.MethodGet, "/a/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, extensions.ProblemContentType, w.Header().Get("Content-Type"))
+
+	// services building their own handler are unchanged.
+	assert.Equal(t, "pong/b", do(http.MethodGet, "/b/ping").Body.String())
+
+	doc, err := NewOpenAPIDocument(newEndpointTestService("/a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Get a user", doc.Paths["/a/users/{name}"]["get"].Summary)
+	assert.Contains(t, doc.Paths["/a/users/{name}"], "delete")
+}
+
+func TestEndpointHandlerErrors(t *testing.T) {
+	testCases := map[string]map[string]*HTTPEndpoint{
+		"no methods": {
+			"/users": {},
+		},
+		"nil handler": {
+			"/users": {Methods: map[string]gin.HandlerFunc{http.MethodGet: nil}},
+		},
+		"conflicting routes": {
+			"/users/:name": {Methods: map[string]gin.HandlerFunc{http.MethodGet: func(c *gin.Context) {}}},
+			"/users/:id":   {Methods: map[string]gin.HandlerFunc{http.MethodGet: func(c *gin.Context) {}}},
+		},
+	}
+
+	for label, endpoints := range testCases {
+		t.Run(label, func(t *testing.T) {
+			svc := newEndpointTestService("")
+			svc.endpoints = endpoints
+			_, err := EndpointHandler(svc)
+			assert.Error(t, err)
+		})
+	}
+
+	svc := newEndpointTestService("")
+	svc.endpoints["/users"] = &HTTPEndpoint{}
+	assert.Error(t, New(svc).Start())
+}
@@ -0,0 +1,36 @@
+package kit
+
+import "strings"
+
+// Errors aggregates the errors reported by several operations, eg. the
+// services hosted by RunContext or the shutdown of a server.
+type Errors []error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// append adds err, if not nil, flattening nested Errors.
+func (e Errors) append(err error) Errors {
+	switch v := err.(type) {
+	case nil:
+		return e
+	case Errors:
+		return append(e, v...)
+	default:
+		return append(e, err)
+	}
+}
+
+// err returns nil when no error was collected.
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
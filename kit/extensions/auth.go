@@ -0,0 +1,410 @@
+package extensions
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClaimsKey is the gin context key holding the verified Claims.
+const ClaimsKey = "jwt_claims"
+
+type claimsKey struct{}
+
+// Claims holds the claims of a verified JSON Web Token.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Scopes returns the scopes granted by the "scope" (space separated) or "scp" claims.
+func (c Claims) Scopes() []string {
+	if scope, ok := c["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return stringList(c["scp"])
+}
+
+// Roles returns the "roles" claim.
+func (c Claims) Roles() []string {
+	return stringList(c["roles"])
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// ContextWithClaims returns a copy of ctx carrying the claims.
+func ContextWithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims verified by JWTHandler or the JWT interceptors.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+// JWTConfig configures the verification of JSON Web Tokens.
+type JWTConfig struct {
+	// Keys maps key IDs (the "kid" header) to verification keys: []byte for HS256,
+	// *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256. Tokens without a
+	// "kid" header are verified with the key registered under the empty ID, or
+	// with the only key when there is just one. See LoadJWKS.
+	Keys map[string]interface{}
+
+	// Algorithms are the accepted signing algorithms. The default is HS256, RS256 and ES256.
+	Algorithms []string
+
+	// Issuer, when set, must match the "iss" claim.
+	Issuer string
+
+	// Audience, when set, must be listed in the "aud" claim.
+	Audience string
+
+	// ClockSkew is the leeway allowed when checking "exp", "nbf" and "iat".
+	ClockSkew time.Duration
+}
+
+// JWTVerifier verifies JSON Web Tokens against static keys.
+type JWTVerifier struct {
+	keys   map[string]interface{}
+	parser *jwt.Parser
+}
+
+// NewJWTVerifier creates a JWTVerifier. Tokens must be signed with one of
+// the configured keys and carry an "exp" claim.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("at least one verification key is required")
+	}
+
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"HS256", "RS256", "ES256"}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithLeeway(cfg.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &JWTVerifier{
+		keys:   cfg.Keys,
+		parser: jwt.NewParser(opts...),
+	}, nil
+}
+
+// Verify checks the signature and the registered claims of the token.
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+		return nil, err
+	}
+
+	return Claims(claims), nil
+}
+
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+
+	return nil, errors.Errorf("unknown key id %q", kid)
+}
+
+// LoadJWKS reads a JSON Web Key Set file and returns its keys indexed by key ID,
+// ready to be used as JWTConfig.Keys. RSA, EC (P-256, P-384, P-521) and
+// symmetric (oct) keys are supported.
+func LoadJWKS(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read JWKS")
+	}
+
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set. See LoadJWKS.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "invalid JWKS")
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		var key interface{}
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			err = errors.Errorf("unsupported key type %q", k.Kty)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid JWKS key %q", k.Kid)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: int(new(big.Int).SetBytes(eb).Int64()),
+	}, nil
+}
+
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.Errorf("unsupported curve %q", crv)
+	}
+
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xb),
+		Y:     new(big.Int).SetBytes(yb),
+	}, nil
+}
+
+// AccessRule lists the scopes and roles required to access a route or an RPC.
+// All the scopes and at least one of the roles, if any, must be granted.
+type AccessRule struct {
+	Scopes []string
+	Roles  []string
+}
+
+// allows reports whether the claims satisfy the rule.
+func (r AccessRule) allows(claims Claims) bool {
+	granted := map[string]bool{}
+	for _, scope := range claims.Scopes() {
+		granted[scope] = true
+	}
+	for _, scope := range r.Scopes {
+		if !granted[scope] {
+			return false
+		}
+	}
+
+	if len(r.Roles) == 0 {
+		return true
+	}
+	for _, role := range claims.Roles() {
+		for _, want := range r.Roles {
+			if role == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+// JWTHandler returns a gin.HandlerFunc (middleware) that authenticates requests
+// with the bearer token of the Authorization header. Verified claims are available
+// through ClaimsFromContext and the ClaimsKey gin context key. Requests without a
+// valid token are aborted with 401.
+func JWTHandler(v *JWTVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			AbortWithStatusJSON(c, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		claims, err := v.Verify(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			AbortWithStatusJSON(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+		c.Request = c.Request.WithContext(ContextWithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// RequireAccess returns a gin.HandlerFunc (middleware) guarding routes with the
+// given rule. It must be used after JWTHandler. Unauthenticated requests are
+// aborted with 401, requests lacking scopes or roles with 403.
+func RequireAccess(rule AccessRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c.Request.Context())
+		if !ok {
+			AbortWithStatusJSON(c, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+
+		if !rule.allows(claims) {
+			AbortWithStatusJSON(c, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScopes is a shortcut for RequireAccess requiring all the given scopes.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return RequireAccess(AccessRule{Scopes: scopes})
+}
+
+// RequireRoles is a shortcut for RequireAccess requiring any of the given roles.
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return RequireAccess(AccessRule{Roles: roles})
+}
+
+// authenticate verifies the bearer token of the incoming metadata and, when
+// a rule is registered for the method, checks access.
+func authenticate(ctx context.Context, v *JWTVerifier, rules map[string]AccessRule, method string) (context.Context, error) {
+	token, ok := bearerToken(metadataValue(ctx, "authorization"))
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if rule, ok := rules[method]; ok && !rule.allows(claims) {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return ContextWithClaims(ctx, claims), nil
+}
+
+// JWTUnaryInterceptor returns a grpc.UnaryServerInterceptor authenticating calls with
+// the bearer token of the authorization metadata. Rules, keyed by full method name
+// (eg. /api.GithubProxy/GetUser), guard individual methods. Failures are reported with
+// codes.Unauthenticated and codes.PermissionDenied.
+func JWTUnaryInterceptor(v *JWTVerifier, rules map[string]AccessRule) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, v, rules, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// JWTStreamInterceptor is the streaming counterpart of JWTUnaryInterceptor.
+func JWTStreamInterceptor(v *JWTVerifier, rules map[string]AccessRule) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), v, rules, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
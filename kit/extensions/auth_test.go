@@ -0,0 +1,196 @@
+package extensions
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testSecret = []byte("secret")
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	assert.NoError(t, err)
+	return token
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "octocat",
+		"iss":   "insighted",
+		"aud":   "kit",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "users:read",
+		"roles": []string{"admin"},
+	}
+}
+
+func newTestVerifier(t *testing.T) *JWTVerifier {
+	v, err := NewJWTVerifier(JWTConfig{
+		Keys:      map[string]interface{}{"": testSecret},
+		Issuer:    "insighted",
+		Audience:  "kit",
+		ClockSkew: time.Minute,
+	})
+	assert.NoError(t, err)
+	return v
+}
+
+func TestJWTVerifier(t *testing.T) {
+	v := newTestVerifier(t)
+
+	testCases := map[string]struct {
+		Claims func(jwt.MapClaims)
+		Valid  bool
+	}{
+		"valid": {
+			Claims: func(jwt.MapClaims) {},
+			Valid:  true,
+		},
+		"expired within skew": {
+			Claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() },
+			Valid:  true,
+		},
+		"expired": {
+			Claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		},
+		"missing expiry": {
+			Claims: func(c jwt.MapClaims) { delete(c, "exp") },
+		},
+		"wrong issuer": {
+			Claims: func(c jwt.MapClaims) { c["iss"] = "someone" },
+		},
+		"wrong audience": {
+			Claims: func(c jwt.MapClaims) { c["aud"] = "other" },
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			claims := validClaims()
+			tc.Claims(claims)
+
+			got, err := v.Verify(signHS256(t, claims))
+			if !tc.Valid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "octocat", got.Subject())
+			assert.Equal(t, []string{"users:read"}, got.Scopes())
+			assert.Equal(t, []string{"admin"}, got.Roles())
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	enc := base64.RawURLEncoding
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"ec1","crv":"P-256","x":%q,"y":%q}]}`,
+		enc.EncodeToString(key.X.Bytes()), enc.EncodeToString(key.Y.Bytes()))
+
+	keys, err := ParseJWKS([]byte(jwks))
+	assert.NoError(t, err)
+
+	v, err := NewJWTVerifier(JWTConfig{Keys: keys})
+	assert.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, validClaims())
+	token.Header["kid"] = "ec1"
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	_, err = v.Verify(signed)
+	assert.NoError(t, err)
+}
+
+func TestJWTHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v := newTestVerifier(t)
+
+	router := gin.New()
+	router.Use(JWTHandler(v))
+	router.GET("/users", RequireScopes("users:read"), func(c *gin.Context) {
+		claims, _ := ClaimsFromContext(c.Request.Context())
+		c.String(http.StatusOK, claims.Subject())
+	})
+	router.DELETE("/users", RequireScopes("users:write"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/admin", RequireRoles("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	testCases := map[string]struct {
+		Method string
+		Path   string
+		Token  string
+		Status int
+	}{
+		"missing token":     {http.MethodGet, "/users", "", http.StatusUnauthorized},
+		"invalid token":     {http.MethodGet, "/users", "Bearer invalid", http.StatusUnauthorized},
+		"granted scope":     {http.MethodGet, "/users", "Bearer " + signHS256(t, validClaims()), http.StatusOK},
+		"missing scope":     {http.MethodDelete, "/users", "Bearer " + signHS256(t, validClaims()), http.StatusForbidden},
+		"granted role":      {http.MethodGet, "/admin", "Bearer " + signHS256(t, validClaims()), http.StatusOK},
+		"lowercase scheme":  {http.MethodGet, "/users", "bearer " + signHS256(t, validClaims()), http.StatusOK},
+		"wrong auth scheme": {http.MethodGet, "/users", "Basic b2N0b2NhdDpzZWNyZXQ=", http.StatusUnauthorized},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.Method, tc.Path, nil)
+			if tc.Token != "" {
+				req.Header.Set("Authorization", tc.Token)
+			}
+
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.Status, w.Code)
+		})
+	}
+}
+
+func TestJWTUnaryInterceptor(t *testing.T) {
+	v := newTestVerifier(t)
+	interceptor := JWTUnaryInterceptor(v, map[string]AccessRule{
+		"/test.Service/Delete": {Scopes: []string{"users:write"}},
+	})
+
+	call := func(method, token string) error {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+
+		info := *testInfo
+		info.FullMethod = method
+		_, err := interceptor(ctx, nil, &info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, ok := ClaimsFromContext(ctx)
+			assert.True(t, ok)
+			return nil, nil
+		})
+		return err
+	}
+
+	token := signHS256(t, validClaims())
+	assert.Equal(t, codes.Unauthenticated, status.Code(call("/test.Service/Get", "")))
+	assert.Equal(t, codes.OK, status.Code(call("/test.Service/Get", token)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/test.Service/Delete", token)))
+}
@@ -0,0 +1,343 @@
+package extensions
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CachePolicy configures the caching of the responses of a route.
+type CachePolicy struct {
+	// CacheControl is the Cache-Control header of the responses, eg.
+	// "public, max-age=60". It is left untouched when empty.
+	CacheControl string
+
+	// Weak generates weak ETags (W/"..."), which only promise semantically
+	// equivalent responses, eg. when proxies may compress them.
+	Weak bool
+
+	// TTL keeps responses in the in-memory cache for the given duration.
+	// Responses are not cached when 0.
+	TTL time.Duration
+
+	// Vary lists the request headers responses depend on, eg. Accept. They
+	// are part of the cache key and listed in the Vary header.
+	Vary []string
+}
+
+// CacheConfig configures CacheHandler.
+type CacheConfig struct {
+	// Policy applies to the routes without an entry in Routes.
+	Policy CachePolicy
+
+	// Routes overrides Policy per route, keyed by gin route, optionally
+	// prefixed with the method (eg. "GET /users/:name" or "/users/:name").
+	Routes map[string]CachePolicy
+
+	// MaxEntries bounds the number of cached responses. The default is 1000.
+	MaxEntries int
+
+	// MaxBytes bounds the total size of the cached bodies. The default is 32MiB.
+	MaxBytes int64
+}
+
+// CacheHandler returns a gin.HandlerFunc (middleware) for GET and HEAD
+// requests. Successful responses get an ETag, computed from the body unless
+// set by the handler, and the Cache-Control of the route; requests whose
+// If-None-Match matches the ETag are answered with 304 Not Modified. Routes
+// with a TTL are served from an in-memory LRU cache keyed by method, URL and
+// Vary headers. Responses setting cookies or marked private or no-store are
+// never cached, nor are the responses to requests with credentials
+// (Authorization or Cookie headers), which may be specific to the user.
+//
+// Responses are buffered: it is not suitable for streaming handlers.
+func CacheHandler(cfg CacheConfig) gin.HandlerFunc {
+	cache := newResponseCache(cfg.MaxEntries, cfg.MaxBytes)
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		policy, ok := cfg.Routes[c.Request.Method+" "+route]
+		if !ok {
+			if policy, ok = cfg.Routes[route]; !ok {
+				policy = cfg.Policy
+			}
+		}
+
+		key := cacheKey(c.Request, policy.Vary)
+		cached := policy.TTL > 0 && !hasCredentials(c.Request)
+		if cached {
+			if entry, ok := cache.get(key, time.Now()); ok {
+				h := c.Writer.Header()
+				for name, values := range entry.header {
+					h[name] = append([]string(nil), values...)
+				}
+				h.Set("Age", strconv.Itoa(int(time.Since(entry.stored)/time.Second)))
+				writeCached(c, entry.status, entry.body)
+				c.Abort()
+				return
+			}
+		}
+
+		// headers set by the previous middleware, eg. the request ID, are not cached.
+		h := c.Writer.Header()
+		before := h.Clone()
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		bufferNext(c, w)
+
+		body := w.body.Bytes()
+		if w.status == http.StatusOK {
+			if h.Get("ETag") == "" {
+				h.Set("ETag", etag(body, policy.Weak))
+			}
+			if policy.CacheControl != "" {
+				h.Set("Cache-Control", policy.CacheControl)
+			}
+			for _, name := range policy.Vary {
+				h.Add("Vary", name)
+			}
+
+			if cached && storable(h) {
+				cache.add(key, &cacheEntry{
+					status:  w.status,
+					header:  headerDiff(before, h),
+					body:    append([]byte(nil), body...),
+					stored:  time.Now(),
+					expires: time.Now().Add(policy.TTL),
+				})
+			}
+		}
+
+		writeCached(c, w.status, body)
+	}
+}
+
+// writeCached writes the response, or 304 Not Modified when the ETag matches If-None-Match.
+func writeCached(c *gin.Context, status int, body []byte) {
+	h := c.Writer.Header()
+	if status == http.StatusOK && etagMatch(c.GetHeader("If-None-Match"), h.Get("ETag")) {
+		h.Del("Content-Length")
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	writeResponse(c, status, body)
+}
+
+func etag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// etagMatch reports whether If-None-Match matches the ETag, using the weak
+// comparison required for conditional GET and HEAD requests.
+func etagMatch(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" || tag == "" {
+		return false
+	}
+
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cacheKey(r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteString(" ")
+	b.WriteString(r.URL.RequestURI())
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString(": ")
+		b.WriteString(r.Header.Get(name))
+	}
+	return b.String()
+}
+
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// headerDiff returns the headers of h added or changed since before.
+func headerDiff(before, h http.Header) http.Header {
+	diff := http.Header{}
+	for name, values := range h {
+		if strings.Join(before[name], "\n") != strings.Join(values, "\n") {
+			diff[name] = append([]string(nil), values...)
+		}
+	}
+	return diff
+}
+
+func storable(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	for _, directive := range strings.Split(strings.ToLower(h.Get("Cache-Control")), ",") {
+		switch strings.TrimSpace(directive) {
+		case "private", "no-store":
+			return false
+		}
+	}
+
+	return true
+}
+
+// bufferedWriter holds the response until the ETag is known.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+// bufferNext runs the pending handlers with their response buffered by w. The
+// writer is restored even when a handler panics; the panic goes on to the
+// outer recovery, which answers on the real writer, and the buffered response
+// is never written.
+func bufferNext(c *gin.Context, w *bufferedWriter) {
+	c.Writer = w
+	defer func() { c.Writer = w.ResponseWriter }()
+	c.Next()
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache is an LRU cache of responses bounded by count and size.
+type responseCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	bytes   int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newResponseCache(maxEntries int, maxBytes int64) *responseCache {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	if maxBytes <= 0 {
+		maxBytes = 32 << 20
+	}
+
+	return &responseCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (rc *responseCache) get(key string, now time.Time) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if now.After(entry.expires) {
+		rc.remove(el)
+		return nil, false
+	}
+
+	rc.lru.MoveToFront(el)
+	return entry, true
+}
+
+func (rc *responseCache) add(key string, entry *cacheEntry) {
+	size := int64(len(entry.body))
+	if size > rc.maxBytes {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if el, ok := rc.entries[key]; ok {
+		rc.remove(el)
+	}
+
+	entry.key = key
+	rc.entries[key] = rc.lru.PushFront(entry)
+	rc.bytes += size
+
+	for rc.lru.Len() > rc.maxEntries || rc.bytes > rc.maxBytes {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+func (rc *responseCache) remove(el *list.Element) {
+	entry := rc.lru.Remove(el).(*cacheEntry)
+	delete(rc.entries, entry.key)
+	rc.bytes -= int64(len(entry.body))
+}
@@ -0,0 +1,174 @@
+package extensions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	router := gin.New()
+	router.Use(CacheHandler(CacheConfig{
+		Policy: CachePolicy{CacheControl: "no-cache"},
+		Routes: map[string]CachePolicy{
+			"GET /users/:name": {CacheControl: "public, max-age=60", TTL: time.Minute, Vary: []string{"Accept"}},
+			"/weak":            {Weak: true},
+		},
+	}))
+	router.GET("/users/:name", func(c *gin.Context) {
+		calls++
+		c.Header("X-Calls", strconv.Itoa(calls))
+		c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "accept": c.GetHeader("Accept")})
+	})
+	router.GET("/weak", func(c *gin.Context) { c.String(http.StatusOK, "weak") })
+	router.GET("/missing", func(c *gin.Context) { c.String(http.StatusNotFound, "missing") })
+
+	do := func(path, accept, ifNoneMatch string, credentials ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(credentials); i += 2 {
+			req.Header.Set(credentials[i], credentials[i+1])
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/users/jane", "application/json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	tag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, tag)
+	body := w.Body.String()
+
+	// served from the cache.
+	w = do("/users/jane", "application/json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body, w.Body.String())
+	assert.Equal(t, tag, w.Header().Get("ETag"))
+	assert.Equal(t, "1", w.Header().Get("X-Calls"))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	assert.Equal(t, 1, calls)
+
+	// conditional requests.
+	w = do("/users/jane", "application/json", tag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, tag, w.Header().Get("ETag"))
+
+	w = do("/users/jane", "application/json", `"other", W/`+tag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// vary headers and paths are part of the key.
+	do("/users/jane", "text/plain", "")
+	assert.Equal(t, 2, calls)
+	do("/users/john", "application/json", "")
+	assert.Equal(t, 3, calls)
+
+	// requests with credentials bypass the cache.
+	w = do("/users/jane", "application/json", "", "Authorization", "Bearer jane")
+	assert.Equal(t, "4", w.Header().Get("X-Calls"))
+	assert.Empty(t, w.Header().Get("Age"))
+	w = do("/users/jane", "application/json", "", "Cookie", "session=john")
+	assert.Equal(t, "5", w.Header().Get("X-Calls"))
+	w = do("/users/jane", "application/json", "")
+	assert.Equal(t, "1", w.Header().Get("X-Calls"))
+	assert.Equal(t, 5, calls)
+
+	w = do("/weak", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+	assert.Equal(t, "weak", w.Body.String())
+	assert.Equal(t, http.StatusNotModified, do("/weak", "", w.Header().Get("ETag")).Code)
+
+	w = do("/missing", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Equal(t, "missing", w.Body.String())
+}
+
+func TestCacheHandlerPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(CacheHandler(CacheConfig{Policy: CachePolicy{TTL: time.Minute}}))
+	router.GET("/panic", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "partial")
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Now()
+	rc := newResponseCache(2, 10)
+	entry := func(body string, ttl time.Duration) *cacheEntry {
+		return &cacheEntry{status: http.StatusOK, body: []byte(body), expires: now.Add(ttl)}
+	}
+
+	rc.add("a", entry("aaa", time.Minute))
+	rc.add("b", entry("bbb", time.Minute))
+	_, ok := rc.get("a", now)
+	assert.True(t, ok)
+
+	// b is the least recently used entry.
+	rc.add("c", entry("ccc", time.Minute))
+	_, ok = rc.get("b", now)
+	assert.False(t, ok)
+
+	// the size limit evicts entries too; oversized entries are not cached.
+	rc.add("d", entry("dddddddd", time.Minute))
+	assert.Equal(t, 1, rc.lru.Len())
+	rc.add("e", entry("eeeeeeeeeee", time.Minute))
+	_, ok = rc.get("e", now)
+	assert.False(t, ok)
+
+	// expired entries are dropped.
+	rc.add("f", entry("f", time.Second))
+	_, ok = rc.get("f", now.Add(2*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, int64(8), rc.bytes)
+}
+
+func TestETagMatch(t *testing.T) {
+	testCases := map[string]struct {
+		IfNoneMatch string
+		ETag        string
+		Match       bool
+	}{
+		"strong":   {`"abc"`, `"abc"`, true},
+		"weak":     {`W/"abc"`, `"abc"`, true},
+		"list":     {`"x", "abc"`, `W/"abc"`, true},
+		"wildcard": {`*`, `"abc"`, true},
+		"mismatch": {`"x"`, `"abc"`, false},
+		"empty":    {``, `"abc"`, false},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			assert.Equal(t, tc.Match, etagMatch(tc.IfNoneMatch, tc.ETag))
+		})
+	}
+}
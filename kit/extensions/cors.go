@@ -0,0 +1,332 @@
+package extensions
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/pkg/errors"
+)
+
+// Default CORS settings, see CORSPolicy.
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCORSHeaders = []string{
+		"Accept",
+		"Authorization",
+		"Content-Type",
+		"Keep-Alive",
+		"Origin",
+		"User-Agent",
+		"X-Requested-With",
+		correlation.RequestIDHeader,
+		correlation.TraceParentHeader,
+		IdempotencyKeyHeader,
+	}
+)
+
+// CORSPolicy configures Cross-Origin Resource Sharing, see NewCORS. It is
+// usually loaded as part of kit.Config.
+type CORSPolicy struct {
+	// AllowOrigins lists the allowed origins (eg. https://example.com). "*" allows
+	// any origin and "https://*.example.com" any subdomain of example.com.
+	AllowOrigins []string `json:"allow_origins"`
+
+	// AllowOriginPatterns are regular expressions matched against the whole
+	// origin, eg. `https://pr-[0-9]+\.preview\.example\.com`.
+	AllowOriginPatterns []string `json:"allow_origin_patterns"`
+
+	// AllowMethods are the methods allowed by preflight requests. The default is DefaultCORSMethods.
+	AllowMethods []string `json:"allow_methods"`
+
+	// AllowHeaders are the request headers allowed by preflight requests; "*"
+	// allows any header. The default is DefaultCORSHeaders.
+	AllowHeaders []string `json:"allow_headers"`
+
+	// ExposeHeaders are the response headers readable by the browser, besides
+	// the CORS-safelisted ones.
+	ExposeHeaders []string `json:"expose_headers"`
+
+	// AllowCredentials lets browsers send cookies and authorization headers.
+	// It cannot be combined with the "*" origin.
+	AllowCredentials bool `json:"allow_credentials"`
+
+	// MaxAge is how long browsers may cache preflight responses. Browsers use
+	// their own default, usually 5s, when 0.
+	MaxAge time.Duration `json:"max_age"`
+
+	// Routes overrides the policy per path. Paths use the gin syntax (eg.
+	// "/users/:name" or "/public/*path"); the longest matching path applies.
+	Routes map[string]CORSPolicy `json:"routes"`
+}
+
+// CORS enforces a CORSPolicy.
+type CORS struct {
+	policy corsPolicy
+	routes []corsRoute
+}
+
+type corsPolicy struct {
+	anyOrigin     bool
+	origins       map[string]bool
+	wildcards     [][2]string
+	patterns      []*regexp.Regexp
+	methods       map[string]bool
+	allowMethods  string
+	anyHeader     bool
+	headers       map[string]bool
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+type corsRoute struct {
+	path   string
+	policy corsPolicy
+}
+
+// NewCORS validates the policy and creates a CORS.
+func NewCORS(p CORSPolicy) (*CORS, error) {
+	policy, err := newCORSPolicy(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CORS{policy: policy}
+	for path, route := range p.Routes {
+		if len(route.Routes) > 0 {
+			return nil, errors.Errorf("CORS policy of route %s cannot have routes", path)
+		}
+
+		policy, err := newCORSPolicy(route)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CORS policy of route %s", path)
+		}
+		c.routes = append(c.routes, corsRoute{path: path, policy: policy})
+	}
+
+	sort.Slice(c.routes, func(i, j int) bool {
+		if len(c.routes[i].path) != len(c.routes[j].path) {
+			return len(c.routes[i].path) > len(c.routes[j].path)
+		}
+		return c.routes[i].path < c.routes[j].path
+	})
+
+	return c, nil
+}
+
+func newCORSPolicy(p CORSPolicy) (corsPolicy, error) {
+	policy := corsPolicy{
+		origins:       map[string]bool{},
+		methods:       map[string]bool{},
+		headers:       map[string]bool{},
+		exposeHeaders: strings.Join(p.ExposeHeaders, ", "),
+		credentials:   p.AllowCredentials,
+	}
+
+	for _, origin := range p.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch n := strings.Count(origin, "*"); {
+		case origin == "*":
+			policy.anyOrigin = true
+		case n == 0:
+			policy.origins[origin] = true
+		case n == 1:
+			i := strings.Index(origin, "*")
+			policy.wildcards = append(policy.wildcards, [2]string{origin[:i], origin[i+1:]})
+		default:
+			return policy, errors.Errorf("invalid CORS origin %q: a single wildcard is allowed", origin)
+		}
+	}
+
+	if policy.anyOrigin && policy.credentials {
+		return policy, errors.New("CORS credentials cannot be allowed for any origin")
+	}
+
+	for _, pattern := range p.AllowOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return policy, errors.Wrapf(err, "invalid CORS origin pattern %q", pattern)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+
+	methods := p.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	allowMethods := make([]string, len(methods))
+	for i, method := range methods {
+		allowMethods[i] = strings.ToUpper(method)
+		policy.methods[allowMethods[i]] = true
+	}
+	policy.allowMethods = strings.Join(allowMethods, ", ")
+
+	headers := p.AllowHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	for _, header := range headers {
+		if header == "*" {
+			policy.anyHeader = true
+		}
+		policy.headers[strings.ToLower(header)] = true
+	}
+	policy.allowHeaders = strings.Join(headers, ", ")
+
+	if p.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(p.MaxAge / time.Second))
+	}
+
+	return policy, nil
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+
+	for _, w := range p.wildcards {
+		if len(origin) > len(w[0])+len(w[1]) && strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) {
+			// the wildcard matches subdomains, not paths or ports.
+			if sub := origin[len(w[0]) : len(origin)-len(w[1])]; !strings.ContainsAny(sub, "/:") {
+				return true
+			}
+		}
+	}
+
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *corsPolicy) allowsHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.ToLower(strings.TrimSpace(header)); header != "" && !p.headers[header] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// policyFor returns the policy of the route matching the request path.
+func (c *CORS) policyFor(path string) *corsPolicy {
+	for i := range c.routes {
+		if matchPath(c.routes[i].path, path) {
+			return &c.routes[i].policy
+		}
+	}
+
+	return &c.policy
+}
+
+// matchPath matches a path against a gin route pattern.
+func matchPath(pattern, path string) bool {
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, p := range patterns {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+
+	return len(patterns) == len(segments)
+}
+
+// CORSPolicyHandler returns a gin.HandlerFunc (middleware) applying the
+// policy. Preflight requests are answered with 204 No Content, or 403 Forbidden
+// when the origin, method or headers are not allowed. Other requests from
+// disallowed origins are served without CORS headers, so browsers do not expose
+// the response.
+func CORSPolicyHandler(c *CORS) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		p := c.policyFor(ctx.Request.URL.Path)
+		h := ctx.Writer.Header()
+		h.Add("Vary", "Origin")
+
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+		if !preflight {
+			if p.allowsOrigin(origin) {
+				p.setOrigin(h, origin)
+				if p.exposeHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+				}
+			}
+			ctx.Next()
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+
+		method := ctx.GetHeader("Access-Control-Request-Method")
+		requested := ctx.GetHeader("Access-Control-Request-Headers")
+		if !p.allowsOrigin(origin) || !p.methods[strings.ToUpper(method)] || !p.allowsHeaders(requested) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		p.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", p.allowMethods)
+		if p.anyHeader && requested != "" {
+			h.Set("Access-Control-Allow-Headers", requested)
+		} else {
+			h.Set("Access-Control-Allow-Headers", p.allowHeaders)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
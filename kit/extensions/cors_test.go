@@ -0,0 +1,143 @@
+package extensions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCORSRouter(t *testing.T, policy CORSPolicy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	c, err := NewCORS(policy)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(CORSPolicyHandler(c))
+	router.GET("/users/:name", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/public/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSRouter(t, CORSPolicy{
+		AllowOrigins:        []string{"https://example.com", "https://*.example.org"},
+		AllowOriginPatterns: []string{`https://pr-[0-9]+\.preview\.example\.net`},
+		AllowHeaders:        []string{"Authorization", "Content-Type"},
+		AllowCredentials:    true,
+		MaxAge:              10 * time.Minute,
+		Routes: map[string]CORSPolicy{
+			"/public/*path": {AllowOrigins: []string{"*"}, AllowMethods: []string{"GET"}},
+		},
+	})
+
+	testCases := map[string]struct {
+		Path        string
+		Origin      string
+		Method      string
+		Headers     string
+		Status      int
+		AllowOrigin string
+		Credentials string
+	}{
+		"exact origin":             {"/users/jane", "https://example.com", "PUT", "Authorization", http.StatusNoContent, "https://example.com", "true"},
+		"wildcard subdomain":       {"/users/jane", "https://api.example.org", "GET", "", http.StatusNoContent, "https://api.example.org", "true"},
+		"nested subdomain":         {"/users/jane", "https://a.b.example.org", "GET", "", http.StatusNoContent, "https://a.b.example.org", "true"},
+		"wildcard apex":            {"/users/jane", "https://example.org", "GET", "", http.StatusForbidden, "", ""},
+		"wildcard port":            {"/users/jane", "https://evil.com:443/.example.org", "GET", "", http.StatusForbidden, "", ""},
+		"origin pattern":           {"/users/jane", "https://pr-42.preview.example.net", "GET", "", http.StatusNoContent, "https://pr-42.preview.example.net", "true"},
+		"origin pattern anchored":  {"/users/jane", "https://pr-42.preview.example.net.evil.com", "GET", "", http.StatusForbidden, "", ""},
+		"disallowed origin":        {"/users/jane", "https://evil.com", "GET", "", http.StatusForbidden, "", ""},
+		"disallowed method":        {"/users/jane", "https://example.com", "TRACE", "", http.StatusForbidden, "", ""},
+		"disallowed header":        {"/users/jane", "https://example.com", "GET", "Authorization, X-Custom", http.StatusForbidden, "", ""},
+		"route any origin":         {"/public/logo.png", "https://evil.com", "GET", "", http.StatusNoContent, "*", ""},
+		"route disallowed method":  {"/public/logo.png", "https://example.com", "POST", "", http.StatusForbidden, "", ""},
+		"header case insensitive":  {"/users/jane", "https://example.com", "GET", "content-type", http.StatusNoContent, "https://example.com", "true"},
+		"origin case insensitive":  {"/users/jane", "HTTPS://EXAMPLE.COM", "GET", "", http.StatusNoContent, "HTTPS://EXAMPLE.COM", "true"},
+		"unmatched route fallback": {"/unknown", "https://example.com", "DELETE", "", http.StatusNoContent, "https://example.com", "true"},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodOptions, tc.Path, nil)
+			req.Header.Set("Origin", tc.Origin)
+			req.Header.Set("Access-Control-Request-Method", tc.Method)
+			if tc.Headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tc.Headers)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Status, w.Code)
+			assert.Equal(t, tc.AllowOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.Credentials, w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Contains(t, w.Header().Values("Vary"), "Origin")
+			if tc.Status == http.StatusNoContent && tc.AllowOrigin != "*" {
+				assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+				assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	router := newCORSRouter(t, CORSPolicy{
+		AllowOrigins:  []string{"https://example.com"},
+		ExposeHeaders: []string{"X-Request-Id"},
+	})
+
+	do := func(origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users/jane", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("https://example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-Id", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// disallowed origins are served, without CORS headers.
+	w = do("https://evil.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = do("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Vary"))
+}
+
+func TestNewCORS(t *testing.T) {
+	testCases := map[string]struct {
+		Policy CORSPolicy
+		Error  bool
+	}{
+		"zero value":           {CORSPolicy{}, false},
+		"any origin":           {CORSPolicy{AllowOrigins: []string{"*"}}, false},
+		"credentials wildcard": {CORSPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}, true},
+		"double wildcard":      {CORSPolicy{AllowOrigins: []string{"https://*.*.example.com"}}, true},
+		"invalid pattern":      {CORSPolicy{AllowOriginPatterns: []string{"("}}, true},
+		"invalid route":        {CORSPolicy{Routes: map[string]CORSPolicy{"/a": {AllowOrigins: []string{"*"}, AllowCredentials: true}}}, true},
+		"nested routes":        {CORSPolicy{Routes: map[string]CORSPolicy{"/a": {Routes: map[string]CORSPolicy{"/b": {}}}}}, true},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			_, err := NewCORS(tc.Policy)
+			if tc.Error {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,23 +1,24 @@
 package extensions
 
 import (
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/satori/go.uuid"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/logging"
 	"github.com/sirupsen/logrus"
 )
 
 // AbortWithStatusJSON is a helper function that calls `Abort()` and then `JSON` internally.
-// This method stops the chain, writes the status code and return a JSON body with HTTP status code and error message.
-// It also sets the Content-Type as "application/json".
+// This method stops the chain, writes the status code and return a problem details body
+// (RFC 7807) with the HTTP status code and error message.
+// It also sets the Content-Type as "application/problem+json".
 func AbortWithStatusJSON(c *gin.Context, code int, message string) {
-	c.AbortWithStatusJSON(code, gin.H{
-		"code":    code,
-		"message": message,
-	})
+	AbortWithProblem(c, NewProblem(code, message))
 }
 
 // NotFoundHandler is a helper function that calls server.AbortWithStatusJSON.
@@ -25,6 +26,22 @@ func NotFoundHandler(c *gin.Context) {
 	AbortWithStatusJSON(c, http.StatusNotFound, http.StatusText(http.StatusNotFound))
 }
 
+// LoggerHandlerOption configures LoggerHandler and SlogLoggerHandler.
+type LoggerHandlerOption func(*loggerHandlerOptions)
+
+type loggerHandlerOptions struct {
+	httpRequest bool
+}
+
+// WithHTTPRequestField also logs the request under the httpRequest field,
+// understood by Google Cloud Logging. It is set by kit.LoggerHandlerOptions
+// for the gcp log format; other formats would log the request twice.
+func WithHTTPRequestField() LoggerHandlerOption {
+	return func(o *loggerHandlerOptions) {
+		o.httpRequest = true
+	}
+}
+
 // LoggerHandler returns a gin.HandlerFunc (middleware) that logs requests using logrus.
 //
 // Requests with errors are logged using logrus.Error().
@@ -33,11 +50,29 @@ func NotFoundHandler(c *gin.Context) {
 // It receives:
 //   1. A time package format string (e.g. time.RFC3339).
 //   2. A boolean stating whether to use UTC time zone or local.
-func LoggerHandler(logger logrus.FieldLogger, timeFormat string, utc bool) gin.HandlerFunc {
+func LoggerHandler(logger logrus.FieldLogger, timeFormat string, utc bool, opts ...LoggerHandlerOption) gin.HandlerFunc {
+	return loggerHandler(logging.FromLogrus(logger), timeFormat, utc, opts)
+}
+
+// SlogLoggerHandler is LoggerHandler logging with a *slog.Logger.
+func SlogLoggerHandler(logger *slog.Logger, timeFormat string, utc bool, opts ...LoggerHandlerOption) gin.HandlerFunc {
+	return loggerHandler(logging.FromSlog(logger), timeFormat, utc, opts)
+}
+
+func loggerHandler(logger logging.Logger, timeFormat string, utc bool, opts []LoggerHandlerOption) gin.HandlerFunc {
+	var o loggerHandlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// handlers retrieving the logger with correlation.Logger still expect logrus.
+	ctxLogger := logging.Logrus(logger)
+
 	return func(c *gin.Context) {
 		start := time.Now()
 		// some evil middlewares modify this values
 		path := c.Request.URL.Path
+		c.Request = c.Request.WithContext(correlation.WithLogger(c.Request.Context(), ctxLogger))
 		c.Next()
 
 		end := time.Now()
@@ -46,7 +81,7 @@ func LoggerHandler(logger logrus.FieldLogger, timeFormat string, utc bool) gin.H
 			end = end.UTC()
 		}
 
-		entry := logger.WithFields(logrus.Fields{
+		fields := logging.Fields{
 			"status":       c.Writer.Status(),
 			"method":       c.Request.Method,
 			"uri":          c.Request.RequestURI,
@@ -54,10 +89,15 @@ func LoggerHandler(logger logrus.FieldLogger, timeFormat string, utc bool) gin.H
 			"content_type": c.ContentType(),
 			"remote-addr":  c.ClientIP(),
 			"user-agent":   c.Request.UserAgent(),
-			"x-request-id": c.GetHeader("X-Request-Id"),
+			"x-request-id": c.GetHeader(correlation.RequestIDHeader),
 			"latency":      latency,
 			"time":         end.Format(timeFormat),
-		})
+		}
+		if o.httpRequest {
+			fields["httpRequest"] = newHTTPRequest(c, latency)
+		}
+
+		entry := logger.WithFields(fields).WithFields(logging.Fields(correlation.Fields(c.Request.Context())))
 
 		if len(c.Errors) > 0 {
 			// Append error field if this is an erroneous request.
@@ -68,37 +108,68 @@ func LoggerHandler(logger logrus.FieldLogger, timeFormat string, utc bool) gin.H
 	}
 }
 
-// CORSHandler returns a gin.HandlerFunc (middleware) to enable CORSHandler support to all origins.
-func CORSHandler() gin.HandlerFunc {
-	config := cors.DefaultConfig()
-	allowHeaders := []string{
-		"Accept",
-		"Authorization",
-		"Content-Type",
-		"Keep-Alive",
-		"Origin",
-		"User-Agent",
-		"X-Requested-With",
+// HTTPRequest describes a request logged by LoggerHandler, under the httpRequest
+// field, with WithHTTPRequestField. It follows the LogEntry HttpRequest schema of Google Cloud Logging.
+type HTTPRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	RequestSize   string `json:"requestSize,omitempty"`
+	Status        int    `json:"status"`
+	ResponseSize  string `json:"responseSize,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Latency       string `json:"latency"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+func newHTTPRequest(c *gin.Context, latency time.Duration) *HTTPRequest {
+	r := &HTTPRequest{
+		RequestMethod: c.Request.Method,
+		RequestURL:    c.Request.RequestURI,
+		Status:        c.Writer.Status(),
+		UserAgent:     c.Request.UserAgent(),
+		RemoteIP:      c.ClientIP(),
+		Referer:       c.Request.Referer(),
+		Latency:       fmt.Sprintf("%.9fs", latency.Seconds()),
+		Protocol:      c.Request.Proto,
 	}
-	config.AllowHeaders = append(config.AllowHeaders, allowHeaders...)
-	config.AllowAllOrigins = true
-	config.AllowCredentials = true
-	return cors.New(config)
+
+	if size := c.Request.ContentLength; size > 0 {
+		r.RequestSize = strconv.FormatInt(size, 10)
+	}
+	if size := c.Writer.Size(); size > 0 {
+		r.ResponseSize = strconv.Itoa(size)
+	}
+
+	return r
+}
+
+// String implements fmt.Stringer, used by text log formatters.
+func (r *HTTPRequest) String() string {
+	return fmt.Sprintf("%s %s %d", r.RequestMethod, r.RequestURL, r.Status)
+}
+
+// CORSHandler returns a gin.HandlerFunc (middleware) to enable CORS support to
+// all origins, without credentials. See CORSPolicyHandler to restrict origins.
+func CORSHandler() gin.HandlerFunc {
+	c, _ := NewCORS(CORSPolicy{AllowOrigins: []string{"*"}})
+	return CORSPolicyHandler(c)
 }
 
 // RequestIDHandler injects a special header X-Request-Id to response headers
 // that could be used to track incoming requests for monitoring/debugging
 // purposes.
+//
+// The request ID, and the trace context of the traceparent header, are stored
+// in the request context; see the correlation package.
 func RequestIDHandler() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
-		reqID := c.GetHeader("X-Request-Id")
-		if reqID == "" {
-			gen := uuid.Must(uuid.NewV4())
-			reqID = gen.String()
-		}
+		ctx := correlation.Incoming(c.Request.Context(), c.GetHeader(correlation.RequestIDHeader), c.GetHeader(correlation.TraceParentHeader))
+		c.Request = c.Request.WithContext(ctx)
 
-		c.Writer.Header().Set("X-Request-Id", reqID)
+		c.Writer.Header().Set(correlation.RequestIDHeader, correlation.RequestID(ctx))
 		c.Next()
 	}
 }
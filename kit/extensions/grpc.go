@@ -0,0 +1,196 @@
+package extensions
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadataKey is the gRPC metadata key carrying the request ID.
+const RequestIDMetadataKey = correlation.RequestIDMetadataKey
+
+// RecoveryUnaryInterceptor returns a grpc.UnaryServerInterceptor that recovers from panics,
+// logs them using logrus and returns a codes.Internal error to the client.
+func RecoveryUnaryInterceptor(logger logrus.FieldLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(logger, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamInterceptor is the streaming counterpart of RecoveryUnaryInterceptor.
+func RecoveryStreamInterceptor(logger logrus.FieldLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(logger, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, stream)
+	}
+}
+
+func recoverPanic(logger logrus.FieldLogger, method string, r interface{}) error {
+	logger.WithFields(logrus.Fields{
+		"method": method,
+		"panic":  r,
+		"stack":  string(debug.Stack()),
+	}).Error("Recovered from panic")
+
+	return status.Errorf(codes.Internal, "%s", "internal error")
+}
+
+// LoggerUnaryInterceptor returns a grpc.UnaryServerInterceptor that logs calls using logrus.
+//
+// Calls with errors are logged using logrus.Error().
+// Calls without errors are logged using logrus.Info().
+func LoggerUnaryInterceptor(logger logrus.FieldLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(correlation.WithLogger(ctx, logger), req)
+		logCall(ctx, logger, info.FullMethod, "unary", start, err)
+		return resp, err
+	}
+}
+
+// LoggerStreamInterceptor is the streaming counterpart of LoggerUnaryInterceptor.
+func LoggerStreamInterceptor(logger logrus.FieldLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = correlation.WithLogger(stream.Context(), logger)
+		err := handler(srv, wrapped)
+		logCall(stream.Context(), logger, info.FullMethod, "stream", start, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger logrus.FieldLogger, method, kind string, start time.Time, err error) {
+	fields := correlation.Fields(ctx)
+	fields["method"] = method
+	fields["type"] = kind
+	fields["code"] = status.Code(err).String()
+	fields["latency"] = time.Since(start)
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["remote-addr"] = p.Addr.String()
+	}
+
+	entry := logger.WithFields(fields)
+	if err != nil {
+		entry.Error(err.Error())
+	} else {
+		entry.Info()
+	}
+}
+
+// RequestIDUnaryInterceptor propagates the x-request-id metadata of incoming calls,
+// generating one when it is missing, and sends it back in the response headers.
+// The request ID, and the trace context of the traceparent metadata, are stored
+// in the call context; see the correlation package.
+func RequestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, reqID := withRequestID(ctx)
+		if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, reqID)); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RequestIDStreamInterceptor is the streaming counterpart of RequestIDUnaryInterceptor.
+func RequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, reqID := withRequestID(stream.Context())
+		if err := stream.SetHeader(metadata.Pairs(RequestIDMetadataKey, reqID)); err != nil {
+			return err
+		}
+
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+func withRequestID(ctx context.Context) (context.Context, string) {
+	// calls served in-process by the gateway carry the IDs of the HTTP request.
+	if reqID := correlation.RequestID(ctx); reqID != "" {
+		return ctx, reqID
+	}
+
+	ctx = correlation.Incoming(ctx, metadataValue(ctx, RequestIDMetadataKey), metadataValue(ctx, correlation.TraceParentMetadataKey))
+	return ctx, correlation.RequestID(ctx)
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// DeadlineUnaryInterceptor bounds every call by the given timeout. Calls without a
+// deadline, or with a deadline further away than the timeout, get the timeout applied.
+// Calls whose deadline already expired are rejected with codes.DeadlineExceeded.
+func DeadlineUnaryInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel, err := withDeadline(ctx, timeout)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
+
+// DeadlineStreamInterceptor is the streaming counterpart of DeadlineUnaryInterceptor.
+func DeadlineStreamInterceptor(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel, err := withDeadline(stream.Context(), timeout)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, status.FromContextError(err).Err()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
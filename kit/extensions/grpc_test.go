@@ -0,0 +1,92 @@
+package extensions
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testInfo = &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+func TestRecoveryUnaryInterceptor(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	_, err := RecoveryUnaryInterceptor(logger)(context.Background(), nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestDeadlineUnaryInterceptor(t *testing.T) {
+	interceptor := DeadlineUnaryInterceptor(time.Second)
+
+	t.Run("applies timeout", func(t *testing.T) {
+		_, err := interceptor(context.Background(), nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+			deadline, ok := ctx.Deadline()
+			assert.True(t, ok)
+			assert.True(t, time.Until(deadline) <= time.Second)
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("keeps shorter deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		want, _ := ctx.Deadline()
+
+		_, err := interceptor(ctx, nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+			got, _ := ctx.Deadline()
+			assert.Equal(t, want, got)
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects expired", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := interceptor(ctx, nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+			t.Fatal("handler should not be called")
+			return nil, nil
+		})
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	})
+}
+
+func TestWithRequestID(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		RequestIDMetadataKey, "abc",
+		correlation.TraceParentMetadataKey, traceParent,
+	))
+	ctx, reqID := withRequestID(ctx)
+	assert.Equal(t, "abc", reqID)
+	assert.Equal(t, "abc", correlation.RequestID(ctx))
+
+	tp, ok := correlation.TraceParentFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tp.TraceIDString())
+	assert.NotEqual(t, "00f067aa0ba902b7", tp.SpanIDString())
+
+	ctx, reqID = withRequestID(context.Background())
+	assert.NotEmpty(t, reqID)
+	assert.Equal(t, reqID, correlation.RequestID(ctx))
+
+	// IDs already in the context, eg. set by the gateway, are kept.
+	ctx = correlation.WithRequestID(ctx, "def")
+	_, reqID = withRequestID(ctx)
+	assert.Equal(t, "def", reqID)
+}
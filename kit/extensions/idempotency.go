@@ -0,0 +1,361 @@
+package extensions
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header identifying retries of a request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on responses replayed by IdempotencyHandler.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	defaultIdempotencyMaxBodyBytes = 1 << 20
+)
+
+// IdempotentResponse is a response stored by IdempotencyHandler.
+type IdempotentResponse struct {
+	// Fingerprint identifies the request the response answers.
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore stores the responses of requests carrying an Idempotency-Key.
+type IdempotencyStore interface {
+	// Lock blocks until the key is free, or until ctx is done, and reserves
+	// it until unlock is called.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+
+	// Get returns the response stored for key, or nil.
+	Get(ctx context.Context, key string) (*IdempotentResponse, error)
+
+	// Put stores the response for key during ttl.
+	Put(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error
+}
+
+// IdempotencyConfig configures IdempotencyHandler.
+type IdempotencyConfig struct {
+	// Store stores the responses. The default is a MemoryIdempotencyStore
+	// bounded by MaxEntries and MaxBytes, which only deduplicates the requests
+	// served by the same process.
+	Store IdempotencyStore
+
+	// MaxEntries bounds the number of responses kept by the default store.
+	// The default is 10000.
+	MaxEntries int
+
+	// MaxBytes bounds the total size of the bodies kept by the default store.
+	// The default is 64MiB.
+	MaxBytes int64
+
+	// TTL is how long responses are replayed. The default is 24h.
+	TTL time.Duration
+
+	// Methods are the methods honoring the header. The default is POST and PATCH.
+	Methods []string
+
+	// Key, when set, scopes the keys per client (eg. KeyBySubject), so clients
+	// cannot replay the responses of each other.
+	Key KeyFunc
+
+	// MaxBodyBytes bounds the request bodies buffered to fingerprint requests
+	// with an Idempotency-Key. Larger ones are rejected with 413 Request Entity
+	// Too Large. The default is 1MiB.
+	MaxBodyBytes int64
+}
+
+// IdempotencyHandler returns a gin.HandlerFunc (middleware) honoring the
+// Idempotency-Key header of mutating requests. The first response for a key is
+// stored, unless it is a server error, and replayed to the retries of the same
+// request, with the Idempotent-Replayed header. Retries are identified by
+// their fingerprint: method, URL and body. A key reused for a different request
+// is rejected with 422 Unprocessable Entity. Concurrent requests with the same
+// key are serialized.
+func IdempotencyHandler(cfg IdempotencyConfig) gin.HandlerFunc {
+	store := cfg.Store
+	if store == nil {
+		store = NewMemoryIdempotencyStore(cfg.MaxEntries, cfg.MaxBytes)
+	}
+
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultIdempotencyMaxBodyBytes
+	}
+
+	methods := map[string]bool{http.MethodPost: true, http.MethodPatch: true}
+	if len(cfg.Methods) > 0 {
+		methods = map[string]bool{}
+		for _, method := range cfg.Methods {
+			methods[method] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			AbortWithStatusJSON(c, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+		if cfg.Key != nil {
+			key = cfg.Key(c) + " " + key
+		}
+
+		fingerprint, err := requestFingerprint(c.Writer, c.Request, maxBodyBytes)
+		if _, ok := err.(*http.MaxBytesError); ok {
+			AbortWithStatusJSON(c, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		if err != nil {
+			AbortWithStatusJSON(c, http.StatusBadRequest, "unable to read the request body")
+			return
+		}
+
+		ctx := c.Request.Context()
+		unlock, err := store.Lock(ctx, key)
+		if err != nil {
+			AbortWithError(c, err)
+			return
+		}
+		defer unlock()
+
+		stored, err := store.Get(ctx, key)
+		if err != nil {
+			AbortWithError(c, err)
+			return
+		}
+
+		if stored != nil {
+			if stored.Fingerprint != fingerprint {
+				AbortWithStatusJSON(c, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+				return
+			}
+
+			h := c.Writer.Header()
+			for name, values := range stored.Header {
+				h[name] = append([]string(nil), values...)
+			}
+			h.Set(IdempotentReplayedHeader, "true")
+			writeResponse(c, stored.Status, stored.Body)
+			c.Abort()
+			return
+		}
+
+		h := c.Writer.Header()
+		before := h.Clone()
+
+		// a panicking handler stores nothing: the retries run it again.
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		bufferNext(c, w)
+
+		body := w.body.Bytes()
+		if w.status < http.StatusInternalServerError {
+			resp := &IdempotentResponse{
+				Fingerprint: fingerprint,
+				Status:      w.status,
+				Header:      headerDiff(before, h),
+				Body:        append([]byte(nil), body...),
+			}
+			if err := store.Put(ctx, key, resp, ttl); err != nil {
+				c.Error(err)
+			}
+		}
+
+		writeResponse(c, w.status, body)
+	}
+}
+
+// requestFingerprint hashes the method, the URL and the body of the request,
+// leaving the body readable by the handler. Bodies larger than maxBodyBytes
+// fail with an *http.MaxBytesError.
+func requestFingerprint(w http.ResponseWriter, r *http.Request, maxBodyBytes int64) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+
+	if r.Body != nil {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		r.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeResponse writes a buffered response.
+func writeResponse(c *gin.Context, status int, body []byte) {
+	c.Writer.WriteHeader(status)
+	c.Writer.WriteHeaderNow()
+	if len(body) > 0 {
+		c.Writer.Write(body)
+	}
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore. It is bounded by
+// count and size: the least recently used responses are evicted first, and
+// their retries are served again.
+type MemoryIdempotencyStore struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu        sync.Mutex
+	bytes     int64
+	lru       *list.List
+	responses map[string]*list.Element
+	locks     map[string]*keyLock
+	swept     time.Time
+}
+
+type memoryIdempotentResponse struct {
+	key     string
+	resp    *IdempotentResponse
+	expires time.Time
+}
+
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// NewMemoryIdempotencyStore creates a MemoryIdempotencyStore keeping up to
+// maxEntries responses and maxBytes of bodies, 10000 and 64MiB when zero.
+func NewMemoryIdempotencyStore(maxEntries int, maxBytes int64) *MemoryIdempotencyStore {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+
+	return &MemoryIdempotencyStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		responses:  map[string]*list.Element{},
+		locks:      map[string]*keyLock{},
+	}
+}
+
+// Lock implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Lock(ctx context.Context, key string) (func(), error) {
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &keyLock{ch: make(chan struct{}, 1)}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	select {
+	case l.ch <- struct{}{}:
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-l.ch
+				s.release(key, l)
+			})
+		}, nil
+
+	case <-ctx.Done():
+		s.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (s *MemoryIdempotencyStore) release(key string, l *keyLock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l.refs--; l.refs == 0 {
+		delete(s.locks, key)
+	}
+}
+
+// Get implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.responses[key]
+	if !ok {
+		return nil, nil
+	}
+
+	stored := el.Value.(*memoryIdempotentResponse)
+	if time.Now().After(stored.expires) {
+		s.remove(el)
+		return nil, nil
+	}
+
+	s.lru.MoveToFront(el)
+	return stored.resp, nil
+}
+
+// Put implements IdempotencyStore. Responses larger than the store are not kept.
+func (s *MemoryIdempotencyStore) Put(_ context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+	size := int64(len(resp.Body))
+	if size > s.maxBytes {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.responses[key]; ok {
+		s.remove(el)
+	}
+
+	now := time.Now()
+	s.responses[key] = s.lru.PushFront(&memoryIdempotentResponse{key: key, resp: resp, expires: now.Add(ttl)})
+	s.bytes += size
+
+	for s.lru.Len() > s.maxEntries || s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+
+	// expired responses are swept at most once a minute.
+	if now.Sub(s.swept) >= time.Minute {
+		s.swept = now
+		for _, el := range s.responses {
+			if now.After(el.Value.(*memoryIdempotentResponse).expires) {
+				s.remove(el)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) remove(el *list.Element) {
+	stored := s.lru.Remove(el).(*memoryIdempotentResponse)
+	delete(s.responses, stored.key)
+	s.bytes -= int64(len(stored.resp.Body))
+}
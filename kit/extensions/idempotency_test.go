@@ -0,0 +1,210 @@
+package extensions
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls int32
+	router := gin.New()
+	router.Use(IdempotencyHandler(IdempotencyConfig{}))
+	router.POST("/orders", func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Header("Location", "/orders/"+strconv.Itoa(int(n)))
+		c.String(http.StatusCreated, string(body))
+	})
+	router.POST("/fail", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Status(http.StatusServiceUnavailable)
+	})
+
+	do := func(path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/orders", "k1", "pizza")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/orders/1", w.Header().Get("Location"))
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+
+	// retries are replayed.
+	w = do("/orders", "k1", "pizza")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "pizza", w.Body.String())
+	assert.Equal(t, "/orders/1", w.Header().Get("Location"))
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the key cannot be reused for another request.
+	w = do("/orders", "k1", "pasta")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	// requests without key are not deduplicated.
+	do("/orders", "", "pizza")
+	do("/orders", "", "pizza")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// server errors are not stored.
+	do("/fail", "k2", "")
+	do("/fail", "k2", "")
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+
+	assert.Equal(t, http.StatusBadRequest, do("/orders", strings.Repeat("k", 256), "").Code)
+
+	// bodies are buffered up to MaxBodyBytes.
+	router = gin.New()
+	router.Use(IdempotencyHandler(IdempotencyConfig{MaxBodyBytes: 5}))
+	router.POST("/orders", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Status(http.StatusCreated)
+	})
+	assert.Equal(t, http.StatusCreated, do("/orders", "k3", "pizza").Code)
+	w = do("/orders", "k4", "pizzas")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyHandlerConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls int32
+	router := gin.New()
+	router.Use(IdempotencyHandler(IdempotencyConfig{}))
+	router.POST("/orders", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		c.String(http.StatusCreated, "created")
+	})
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("pizza"))
+			req.Header.Set(IdempotencyKeyHeader, "k1")
+			router.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, []int{201, 201, 201, 201, 201}, codes)
+}
+
+func TestIdempotencyHandlerPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls int32
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(IdempotencyHandler(IdempotencyConfig{}))
+	router.POST("/orders", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.String(http.StatusCreated, "partial")
+		panic("boom")
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("pizza"))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "partial")
+		assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore(0, 0)
+
+	unlock, err := store.Lock(ctx, "k")
+	assert.NoError(t, err)
+
+	// the key is reserved until unlocked.
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = store.Lock(timeout, "k")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	unlock()
+	unlock, err = store.Lock(ctx, "k")
+	assert.NoError(t, err)
+	unlock()
+	assert.Empty(t, store.locks)
+
+	resp := &IdempotentResponse{Fingerprint: "f", Status: http.StatusOK}
+	assert.NoError(t, store.Put(ctx, "k", resp, time.Minute))
+	stored, err := store.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, resp, stored)
+
+	assert.NoError(t, store.Put(ctx, "expired", resp, -time.Second))
+	stored, err = store.Get(ctx, "expired")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestMemoryIdempotencyStoreBounds(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore(2, 10)
+	put := func(key, body string) {
+		assert.NoError(t, store.Put(ctx, key, &IdempotentResponse{Body: []byte(body)}, time.Minute))
+	}
+	stored := func(key string) bool {
+		resp, err := store.Get(ctx, key)
+		assert.NoError(t, err)
+		return resp != nil
+	}
+
+	// the least recently used response is evicted past MaxEntries.
+	put("a", "1")
+	put("b", "2")
+	assert.True(t, stored("a"))
+	put("c", "3")
+	assert.True(t, stored("a"))
+	assert.False(t, stored("b"))
+	assert.True(t, stored("c"))
+
+	// and past MaxBytes.
+	put("d", "1234567890")
+	assert.False(t, stored("a"))
+	assert.False(t, stored("c"))
+	assert.True(t, stored("d"))
+	assert.Equal(t, int64(10), store.bytes)
+
+	// responses larger than the store are not kept.
+	put("e", "12345678901")
+	assert.False(t, stored("e"))
+	assert.Len(t, store.responses, 1)
+}
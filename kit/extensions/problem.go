@@ -0,0 +1,292 @@
+package extensions
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/eventsourcing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProblemContentType is the media type of problem details responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is a problem details object, as defined by RFC 7807. It implements
+// error, so handlers can report it with c.Error or return it from RPCs.
+type Problem struct {
+	// Type is a URI identifying the problem type. It defaults to about:blank.
+	Type string `json:"type,omitempty"`
+
+	// Title is a short summary of the problem type.
+	Title string `json:"title"`
+
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+
+	// Instance is the path of the request that caused the problem.
+	Instance string `json:"instance,omitempty"`
+
+	// Code classifies the error, eg. eventsourcing.ErrorAggregateNotFound.
+	Code string `json:"code,omitempty"`
+}
+
+// NewProblem creates a Problem with the given status and detail.
+func NewProblem(code int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(code),
+		Status: code,
+		Detail: detail,
+	}
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// GRPCStatus converts the problem into a gRPC status, so it can be returned by RPCs.
+func (p *Problem) GRPCStatus() *status.Status {
+	return status.New(codeFromHTTPStatus(p.Status), p.Error())
+}
+
+// ErrorMapping maps an error code to the HTTP and gRPC statuses reported to clients.
+type ErrorMapping struct {
+	// Status is the HTTP status code.
+	Status int
+
+	// Code is the gRPC status code.
+	Code codes.Code
+
+	// Type is the optional problem type URI.
+	Type string
+}
+
+var (
+	errorMappingsMu sync.RWMutex
+	errorMappings   = map[string]ErrorMapping{
+		eventsourcing.ErrorInvalidArgument:   {Status: http.StatusBadRequest, Code: codes.InvalidArgument},
+		eventsourcing.ErrorUnhandledCommand:  {Status: http.StatusBadRequest, Code: codes.InvalidArgument},
+		eventsourcing.ErrorAggregateNotFound: {Status: http.StatusNotFound, Code: codes.NotFound},
+		eventsourcing.ErrorInvalidEncoding:   {Status: http.StatusInternalServerError, Code: codes.Internal},
+		eventsourcing.ErrorUnboundEventType:  {Status: http.StatusInternalServerError, Code: codes.Internal},
+		eventsourcing.ErrorAggregateNotSaved: {Status: http.StatusInternalServerError, Code: codes.Internal},
+		eventsourcing.ErrorUnhandledEvent:    {Status: http.StatusInternalServerError, Code: codes.Internal},
+	}
+)
+
+// RegisterErrorMapping registers the statuses reported for errors with the given
+// code, as returned by their Code() string method. eventsourcing.Error codes are
+// registered by default and can be overridden.
+func RegisterErrorMapping(code string, mapping ErrorMapping) {
+	errorMappingsMu.Lock()
+	defer errorMappingsMu.Unlock()
+
+	errorMappings[code] = mapping
+}
+
+type codedError interface {
+	Code() string
+}
+
+// mappedError walks the cause chain of err and returns the first error with a
+// registered code.
+func mappedError(err error) (codedError, ErrorMapping, bool) {
+	errorMappingsMu.RLock()
+	defer errorMappingsMu.RUnlock()
+
+	for err != nil {
+		if coded, ok := err.(codedError); ok {
+			if mapping, ok := errorMappings[coded.Code()]; ok {
+				return coded, mapping, true
+			}
+		}
+
+		switch v := err.(type) {
+		case interface{ Cause() error }:
+			err = v.Cause()
+		case interface{ Unwrap() error }:
+			err = v.Unwrap()
+		default:
+			err = nil
+		}
+	}
+
+	return nil, ErrorMapping{}, false
+}
+
+// errorMessage returns the message of eventsourcing.Error values, without their cause.
+func errorMessage(err interface{}) string {
+	if v, ok := err.(interface{ Message() string }); ok {
+		return v.Message()
+	}
+	if v, ok := err.(error); ok {
+		return v.Error()
+	}
+	return ""
+}
+
+// ProblemFromError converts err into a Problem. Problems are returned as is,
+// gRPC status errors and errors with a registered code are mapped to their
+// HTTP status. Other errors are reported as 500 without details, as their
+// message may leak internals.
+func ProblemFromError(err error) *Problem {
+	if p, ok := err.(*Problem); ok {
+		return p
+	}
+
+	if coded, mapping, ok := mappedError(err); ok {
+		p := NewProblem(mapping.Status, errorMessage(coded))
+		p.Type = mapping.Type
+		p.Code = coded.Code()
+		return p
+	}
+
+	if st, ok := status.FromError(err); ok && err != nil {
+		return NewProblem(HTTPStatusFromCode(st.Code()), st.Message())
+	}
+
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// StatusFromError converts err into a gRPC status. Errors with a registered
+// code are mapped to their gRPC code; other errors are left to gRPC.
+func StatusFromError(err error) (*status.Status, bool) {
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return status.Convert(err), true
+	}
+
+	if coded, mapping, ok := mappedError(err); ok {
+		return status.New(mapping.Code, errorMessage(coded)), true
+	}
+
+	return nil, false
+}
+
+// AbortWithProblem calls `Abort()` and writes the problem with the
+// application/problem+json content type. The instance defaults to the request
+// path; p is left untouched, so it may be a shared value.
+func AbortWithProblem(c *gin.Context, p *Problem) {
+	cp := *p
+	if cp.Instance == "" {
+		cp.Instance = c.Request.URL.Path
+	}
+
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(cp.Status, &cp)
+}
+
+// AbortWithError records err in the gin context, so it is logged by
+// LoggerHandler, and aborts the request with the problem it maps to.
+func AbortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	AbortWithProblem(c, ProblemFromError(err))
+}
+
+// ErrorHandler returns a gin.HandlerFunc (middleware) rendering the last error
+// added with c.Error as a problem details response, unless the handler already
+// wrote a response.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		AbortWithProblem(c, ProblemFromError(c.Errors.Last().Err))
+	}
+}
+
+// ErrorUnaryInterceptor returns a grpc.UnaryServerInterceptor converting errors
+// with a registered code into gRPC status errors.
+func ErrorUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if st, ok := StatusFromError(err); ok {
+			return resp, st.Err()
+		}
+
+		return resp, err
+	}
+}
+
+// ErrorStreamInterceptor is the streaming counterpart of ErrorUnaryInterceptor.
+func ErrorStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, stream)
+		if st, ok := StatusFromError(err); ok {
+			return st.Err()
+		}
+
+		return err
+	}
+}
+
+// HTTPStatusFromCode converts a gRPC status code into the corresponding HTTP status code.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// codeFromHTTPStatus converts an HTTP status code into the closest gRPC status code.
+func codeFromHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		// a Problem is always an error, including with a non-error status.
+		return codes.Unknown
+	}
+}
@@ -0,0 +1,199 @@
+package extensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/eventsourcing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestProblemFromError(t *testing.T) {
+	RegisterErrorMapping("quota exceeded", ErrorMapping{
+		Status: http.StatusPaymentRequired,
+		Code:   codes.ResourceExhausted,
+		Type:   "https://example.com/problems/quota",
+	})
+
+	testCases := map[string]struct {
+		Err    error
+		Status int
+		Code   string
+		Detail string
+		Type   string
+	}{
+		"aggregate not found": {
+			Err:    eventsourcing.NewError(nil, eventsourcing.ErrorAggregateNotFound, "no aggregate found with id %v", "abc"),
+			Status: http.StatusNotFound,
+			Code:   eventsourcing.ErrorAggregateNotFound,
+			Detail: "no aggregate found with id abc",
+		},
+		"nested invalid argument": {
+			Err: eventsourcing.NewError(
+				eventsourcing.NewError(nil, eventsourcing.ErrorInvalidArgument, "blank aggregate ID"),
+				"unregistered",
+				"dispatch failed",
+			),
+			Status: http.StatusBadRequest,
+			Code:   eventsourcing.ErrorInvalidArgument,
+			Detail: "blank aggregate ID",
+		},
+		"registered mapping": {
+			Err:    eventsourcing.NewError(nil, "quota exceeded", "quota exceeded"),
+			Status: http.StatusPaymentRequired,
+			Code:   "quota exceeded",
+			Detail: "quota exceeded",
+			Type:   "https://example.com/problems/quota",
+		},
+		"grpc status": {
+			Err:    status.Error(codes.NotFound, "user not found"),
+			Status: http.StatusNotFound,
+			Detail: "user not found",
+		},
+		"problem": {
+			Err:    NewProblem(http.StatusConflict, "already exists"),
+			Status: http.StatusConflict,
+			Detail: "already exists",
+		},
+		"unknown": {
+			Err:    errors.New("connection refused"),
+			Status: http.StatusInternalServerError,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			p := ProblemFromError(tc.Err)
+			assert.Equal(t, tc.Status, p.Status)
+			assert.Equal(t, http.StatusText(tc.Status), p.Title)
+			assert.Equal(t, tc.Code, p.Code)
+			assert.Equal(t, tc.Detail, p.Detail)
+			assert.Equal(t, tc.Type, p.Type)
+		})
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.GET("/users/:id", func(c *gin.Context) {
+		c.Error(eventsourcing.NewError(nil, eventsourcing.ErrorAggregateNotFound, "user %s not found", c.Param("id")))
+	})
+	router.GET("/written", func(c *gin.Context) {
+		c.Error(errors.New("ignored"))
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	var p Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, Problem{
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "user 42 not found",
+		Instance: "/users/42",
+		Code:     eventsourcing.ErrorAggregateNotFound,
+	}, p)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestAbortWithStatusJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.NoRoute(NotFoundHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"title":"Not Found","status":404,"detail":"Not Found","instance":"/missing"}`, w.Body.String())
+}
+
+func TestAbortWithProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	errQuota := NewProblem(http.StatusTooManyRequests, "quota exceeded")
+	router := gin.New()
+	router.GET("/users/:id", func(c *gin.Context) {
+		AbortWithError(c, errQuota)
+	})
+
+	// a shared problem is rendered with the path of each request.
+	for _, path := range []string{"/users/1", "/users/2"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		var p Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, path, p.Instance)
+	}
+	assert.Empty(t, errQuota.Instance)
+}
+
+func TestErrorUnaryInterceptor(t *testing.T) {
+	testCases := map[string]struct {
+		Err  error
+		Code codes.Code
+	}{
+		"nil": {
+			Err:  nil,
+			Code: codes.OK,
+		},
+		"eventsourcing": {
+			Err:  eventsourcing.NewError(nil, eventsourcing.ErrorInvalidArgument, "invalid"),
+			Code: codes.InvalidArgument,
+		},
+		"problem": {
+			Err:  NewProblem(http.StatusNotFound, "not found"),
+			Code: codes.NotFound,
+		},
+		"problem with a success status": {
+			Err:  NewProblem(http.StatusOK, "ok"),
+			Code: codes.Unknown,
+		},
+		"status": {
+			Err:  status.Error(codes.Unavailable, "unavailable"),
+			Code: codes.Unavailable,
+		},
+		"unknown": {
+			Err:  errors.New("boom"),
+			Code: codes.Unknown,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			_, err := ErrorUnaryInterceptor()(context.Background(), nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, tc.Err
+			})
+			assert.Equal(t, tc.Code, status.Code(err))
+		})
+	}
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatusFromCode(codes.OK))
+	assert.Equal(t, http.StatusBadRequest, HTTPStatusFromCode(codes.InvalidArgument))
+	assert.Equal(t, http.StatusNotFound, HTTPStatusFromCode(codes.NotFound))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusFromCode(codes.Unauthenticated))
+	assert.Equal(t, http.StatusForbidden, HTTPStatusFromCode(codes.PermissionDenied))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatusFromCode(codes.Unknown))
+}
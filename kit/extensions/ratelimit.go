@@ -0,0 +1,447 @@
+package extensions
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimit is a token bucket limit: clients may issue Requests per Period on
+// average, with bursts of up to Burst requests. Burst defaults to Requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// RateLimitConfig configures RateLimitHandler and the rate limit interceptors.
+type RateLimitConfig struct {
+	// Limit applies to the routes and methods without an entry in Routes.
+	// The zero value disables limiting.
+	Limit RateLimit
+
+	// Routes overrides Limit per route. HTTP routes are keyed by gin route,
+	// optionally prefixed with the method (eg. "GET /users/:name" or
+	// "/users/:name"), gRPC methods by full method name (eg. /api.GithubProxy/GetUser).
+	// Each route has its own buckets.
+	Routes map[string]RateLimit
+}
+
+// Validate reports whether the limit is consistent: a limit with Requests
+// must have a Period.
+func (l RateLimit) Validate() error {
+	switch {
+	case l.Requests < 0 || l.Burst < 0 || l.Period < 0:
+		return errors.New("rate limit cannot be negative")
+	case l.Requests > 0 && l.Period == 0:
+		return errors.Errorf("rate limit of %d requests has no period", l.Requests)
+	}
+	return nil
+}
+
+// Validate reports whether the default limit and the limits of every route
+// are consistent.
+func (c RateLimitConfig) Validate() error {
+	if err := c.Limit.Validate(); err != nil {
+		return err
+	}
+	for route, limit := range c.Routes {
+		if err := limit.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid rate limit of route %s", route)
+		}
+	}
+	return nil
+}
+
+// KeyFunc returns the key identifying the client of an HTTP request.
+type KeyFunc func(c *gin.Context) string
+
+// RPCKeyFunc returns the key identifying the client of a gRPC call.
+type RPCKeyFunc func(ctx context.Context) string
+
+// KeyByIP identifies clients by the IP address of the connection. Behind a
+// reverse proxy, every client shares the address of the proxy: see KeyByClientIP.
+func KeyByIP(c *gin.Context) string {
+	return c.RemoteIP()
+}
+
+// KeyByClientIP identifies clients by the IP address gin resolves from the
+// X-Forwarded-For and X-Real-IP headers. The headers are set by the clients
+// themselves unless the engine only trusts the proxies in front of the service
+// (see gin.Engine SetTrustedProxies): gin trusts every proxy by default, which
+// lets any client pick a new key per request and bypass the limit.
+func KeyByClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// KeyByHeader identifies clients by the given header, eg. an API key, falling
+// back to KeyByIP.
+func KeyByHeader(name string) KeyFunc {
+	return func(c *gin.Context) string {
+		if v := c.GetHeader(name); v != "" {
+			return name + ":" + v
+		}
+		return KeyByIP(c)
+	}
+}
+
+// KeyBySubject identifies clients by the subject of the claims verified by
+// JWTHandler, falling back to KeyByIP.
+func KeyBySubject(c *gin.Context) string {
+	if claims, ok := ClaimsFromContext(c.Request.Context()); ok && claims.Subject() != "" {
+		return "sub:" + claims.Subject()
+	}
+	return KeyByIP(c)
+}
+
+// RPCKeyByPeer identifies clients by the IP address of the peer.
+func RPCKeyByPeer(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// RPCKeyByMetadata identifies clients by the given metadata key, eg. an API key,
+// falling back to the peer address.
+func RPCKeyByMetadata(key string) RPCKeyFunc {
+	return func(ctx context.Context) string {
+		if v := metadataValue(ctx, key); v != "" {
+			return key + ":" + v
+		}
+		return RPCKeyByPeer(ctx)
+	}
+}
+
+// RPCKeyBySubject identifies clients by the subject of the claims verified by
+// the JWT interceptors, falling back to the peer address.
+func RPCKeyBySubject(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.Subject() != "" {
+		return "sub:" + claims.Subject()
+	}
+	return RPCKeyByPeer(ctx)
+}
+
+// RateLimiter holds a token bucket per client key. Idle buckets are evicted
+// once they are full again, so memory is bounded by the active clients.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// rateDecision is the outcome of a request against a RateLimiter.
+type rateDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// NewRateLimiter creates a RateLimiter enforcing the given limit. It panics
+// if the limit is invalid; a zero limit allows every request.
+func NewRateLimiter(l RateLimit) *RateLimiter {
+	if err := l.Validate(); err != nil {
+		panic(err)
+	}
+
+	burst := l.Burst
+	if burst <= 0 {
+		burst = l.Requests
+	}
+
+	limit := rate.Inf
+	if l.Requests > 0 {
+		limit = rate.Limit(float64(l.Requests) / l.Period.Seconds())
+	}
+
+	return &RateLimiter{
+		limit:   limit,
+		burst:   burst,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow reports whether a request of the client identified by key may proceed.
+func (rl *RateLimiter) Allow(key string) bool {
+	return rl.take(key, time.Now()).allowed
+}
+
+// fillTime is the time an empty bucket takes to fill up.
+func (rl *RateLimiter) fillTime() time.Duration {
+	return time.Duration(float64(rl.burst) / float64(rl.limit) * float64(time.Second))
+}
+
+func (rl *RateLimiter) take(key string, now time.Time) rateDecision {
+	if rl.limit == rate.Inf {
+		return rateDecision{allowed: true}
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.buckets[key] = b
+	}
+	b.seen = now
+
+	d := rateDecision{
+		allowed: b.limiter.AllowN(now, 1),
+		limit:   rl.burst,
+	}
+
+	tokens := b.limiter.TokensAt(now)
+	if tokens > 0 {
+		d.remaining = int(tokens)
+	}
+	d.reset = time.Duration((float64(rl.burst) - tokens) / float64(rl.limit) * float64(time.Second))
+	if !d.allowed {
+		d.retryAfter = time.Duration((1 - tokens) / float64(rl.limit) * float64(time.Second))
+	}
+
+	return d
+}
+
+// sweep evicts the buckets that have been idle long enough to be full again,
+// as they are indistinguishable from new ones.
+func (rl *RateLimiter) sweep(now time.Time) {
+	idle := rl.fillTime()
+	if now.Sub(rl.lastSweep) < idle {
+		return
+	}
+	rl.lastSweep = now
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.seen) >= idle {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// rateLimiters resolves the RateLimiter of routes and methods.
+type rateLimiters struct {
+	fallback *RateLimiter
+	routes   map[string]*RateLimiter
+}
+
+// newRateLimiters panics if the config is invalid, as the middleware and
+// interceptors are set up when the service starts.
+func newRateLimiters(cfg RateLimitConfig) *rateLimiters {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+
+	rls := &rateLimiters{
+		fallback: NewRateLimiter(cfg.Limit),
+		routes:   map[string]*RateLimiter{},
+	}
+	for route, limit := range cfg.Routes {
+		rls.routes[route] = NewRateLimiter(limit)
+	}
+	return rls
+}
+
+func (rls *rateLimiters) get(routes ...string) *RateLimiter {
+	for _, route := range routes {
+		if rl, ok := rls.routes[route]; ok {
+			return rl
+		}
+	}
+	return rls.fallback
+}
+
+// seconds rounds d up to whole seconds, as used by the rate limit headers.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimitHandler returns a gin.HandlerFunc (middleware) enforcing the configured
+// limits per client, as identified by key (eg. KeyByIP, KeyByHeader("X-Api-Key")
+// or KeyBySubject). It sets the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and aborts requests over the limit with 429 and a
+// Retry-After header. It panics if the config is invalid.
+func RateLimitHandler(cfg RateLimitConfig, key KeyFunc) gin.HandlerFunc {
+	limiters := newRateLimiters(cfg)
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		rl := limiters.get(c.Request.Method+" "+route, route)
+
+		d := rl.take(key(c), time.Now())
+		if d.limit > 0 {
+			c.Header("RateLimit-Limit", strconv.Itoa(d.limit))
+			c.Header("RateLimit-Remaining", strconv.Itoa(d.remaining))
+			c.Header("RateLimit-Reset", seconds(d.reset))
+		}
+
+		if !d.allowed {
+			c.Header("Retry-After", seconds(d.retryAfter))
+			AbortWithStatusJSON(c, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// limitCall checks the rate limit of a gRPC call, reporting rejections with
+// codes.ResourceExhausted and a retry-after header.
+func limitCall(ctx context.Context, limiters *rateLimiters, key RPCKeyFunc, method string) error {
+	d := limiters.get(method).take(key(ctx), time.Now())
+	if d.allowed {
+		return nil
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", seconds(d.retryAfter)))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %ss", seconds(d.retryAfter))
+}
+
+// RateLimitUnaryInterceptor returns a grpc.UnaryServerInterceptor enforcing the
+// configured limits per client, as identified by key (eg. RPCKeyByPeer).
+// Calls over the limit fail with codes.ResourceExhausted. It panics if the
+// config is invalid.
+func RateLimitUnaryInterceptor(cfg RateLimitConfig, key RPCKeyFunc) grpc.UnaryServerInterceptor {
+	limiters := newRateLimiters(cfg)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := limitCall(ctx, limiters, key, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor is the streaming counterpart of RateLimitUnaryInterceptor.
+// Limits apply to the opening of streams, not to their messages.
+func RateLimitStreamInterceptor(cfg RateLimitConfig, key RPCKeyFunc) grpc.StreamServerInterceptor {
+	limiters := newRateLimiters(cfg)
+
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := limitCall(stream.Context(), limiters, key, info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, stream)
+	}
+}
+
+// ConcurrencyLimiter bounds the number of requests in flight. A single limiter
+// can be shared by the HTTP middleware and the gRPC interceptors to bound the
+// load of the whole process.
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter allowing up to max requests
+// in flight. A max of zero or less does not limit requests.
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	if max <= 0 {
+		return &ConcurrencyLimiter{}
+	}
+
+	return &ConcurrencyLimiter{
+		slots: make(chan struct{}, max),
+	}
+}
+
+// Acquire reserves a slot without blocking. It reports false when max
+// requests are already in flight; otherwise Release must be called.
+func (l *ConcurrencyLimiter) Acquire() bool {
+	if l.slots == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot reserved by Acquire.
+func (l *ConcurrencyLimiter) Release() {
+	if l.slots == nil {
+		return
+	}
+
+	<-l.slots
+}
+
+// InFlight returns the number of requests in flight.
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// ConcurrencyLimitHandler returns a gin.HandlerFunc (middleware) shedding load:
+// requests exceeding the limiter capacity are aborted with 503 and a Retry-After header.
+func ConcurrencyLimitHandler(l *ConcurrencyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.Acquire() {
+			c.Header("Retry-After", "1")
+			AbortWithStatusJSON(c, http.StatusServiceUnavailable, "server overloaded")
+			return
+		}
+		defer l.Release()
+
+		c.Next()
+	}
+}
+
+// ConcurrencyLimitUnaryInterceptor returns a grpc.UnaryServerInterceptor shedding
+// load: calls exceeding the limiter capacity fail with codes.ResourceExhausted.
+func ConcurrencyLimitUnaryInterceptor(l *ConcurrencyLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !l.Acquire() {
+			return nil, status.Error(codes.ResourceExhausted, "server overloaded")
+		}
+		defer l.Release()
+
+		return handler(ctx, req)
+	}
+}
+
+// ConcurrencyLimitStreamInterceptor is the streaming counterpart of
+// ConcurrencyLimitUnaryInterceptor. Open streams hold a slot until they end.
+func ConcurrencyLimitStreamInterceptor(l *ConcurrencyLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !l.Acquire() {
+			return status.Error(codes.ResourceExhausted, "server overloaded")
+		}
+		defer l.Release()
+
+		return handler(srv, stream)
+	}
+}
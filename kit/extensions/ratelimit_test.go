@@ -0,0 +1,197 @@
+package extensions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{Requests: 2, Period: time.Second})
+	now := time.Now()
+
+	assert.True(t, rl.take("a", now).allowed)
+	assert.True(t, rl.take("a", now).allowed)
+
+	d := rl.take("a", now)
+	assert.False(t, d.allowed)
+	assert.Equal(t, 0, d.remaining)
+	assert.Equal(t, "1", seconds(d.retryAfter))
+
+	// buckets are per key
+	assert.True(t, rl.take("b", now).allowed)
+
+	// tokens are refilled over time
+	assert.True(t, rl.take("a", now.Add(500*time.Millisecond)).allowed)
+
+	// idle buckets are evicted
+	rl.take("c", now.Add(2*time.Second))
+	assert.Len(t, rl.buckets, 1)
+}
+
+func TestKeyByIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, engine := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	// the forwarded headers are ignored unless opted in.
+	assert.Equal(t, "10.0.0.1", KeyByIP(c))
+	assert.Equal(t, "203.0.113.7", KeyByClientIP(c))
+
+	assert.NoError(t, engine.SetTrustedProxies([]string{"192.168.0.1"}))
+	assert.Equal(t, "10.0.0.1", KeyByClientIP(c))
+}
+
+func TestRateLimitConfigValidate(t *testing.T) {
+	testCases := map[string]struct {
+		Config RateLimitConfig
+		Err    bool
+	}{
+		"zero value": {
+			Config: RateLimitConfig{},
+		},
+		"limit": {
+			Config: RateLimitConfig{Limit: RateLimit{Requests: 10, Period: time.Second}},
+		},
+		"no period": {
+			Config: RateLimitConfig{Limit: RateLimit{Requests: 10}},
+			Err:    true,
+		},
+		"negative": {
+			Config: RateLimitConfig{Limit: RateLimit{Requests: -1, Period: time.Second}},
+			Err:    true,
+		},
+		"route without period": {
+			Config: RateLimitConfig{Routes: map[string]RateLimit{"/users": {Requests: 10}}},
+			Err:    true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			err := tc.Config.Validate()
+			if tc.Err {
+				assert.Error(t, err)
+				assert.Panics(t, func() { RateLimitHandler(tc.Config, KeyByIP) })
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimitHandler(RateLimitConfig{
+		Limit: RateLimit{Requests: 2, Period: time.Minute},
+		Routes: map[string]RateLimit{
+			"POST /users": {Requests: 1, Period: time.Minute},
+		},
+	}, KeyByHeader("X-Api-Key")))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/users", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	do := func(method, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/users", nil)
+		req.Header.Set("X-Api-Key", key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "alice").Code)
+
+	w = do(http.MethodGet, "alice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "bob").Code)
+
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "alice").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "alice").Code)
+}
+
+func TestRateLimitUnaryInterceptor(t *testing.T) {
+	interceptor := RateLimitUnaryInterceptor(RateLimitConfig{
+		Limit: RateLimit{Requests: 1, Period: time.Minute},
+	}, RPCKeyByMetadata("x-api-key"))
+
+	call := func(key string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", key))
+		_, err := interceptor(ctx, nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+
+	assert.NoError(t, call("alice"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("alice")))
+	assert.NoError(t, call("bob"))
+}
+
+func TestConcurrencyLimitHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := NewConcurrencyLimiter(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(ConcurrencyLimitHandler(limiter))
+	router.GET("/", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- w.Code
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	_, err := ConcurrencyLimitUnaryInterceptor(limiter)(context.Background(), nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("handler should not be called")
+		return nil, nil
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+func TestConcurrencyLimiterUnlimited(t *testing.T) {
+	limiter := NewConcurrencyLimiter(0)
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.Acquire())
+	}
+	limiter.Release()
+	assert.Equal(t, 0, limiter.InFlight())
+}
@@ -0,0 +1,219 @@
+package extensions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TracerName is the name of the OpenTelemetry tracer of the kit middleware.
+const TracerName = "github.com/insighted4/insighted-go/kit"
+
+var tracePropagator = propagation.TraceContext{}
+
+// TracingOption configures the tracing middleware and interceptors.
+type TracingOption func(*tracingOptions)
+
+type tracingOptions struct {
+	provider trace.TracerProvider
+}
+
+// WithTracerProvider records the spans with the given provider, eg. the
+// provider of a kit.Server, instead of the provider carried by the request
+// context.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(o *tracingOptions) {
+		o.provider = provider
+	}
+}
+
+func newTracingOptions(opts []TracingOption) tracingOptions {
+	var o tracingOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// tracer is looked up per call, so the middleware follows the provider of the
+// server serving the request rather than the one set when it was built.
+func (o tracingOptions) tracer(ctx context.Context) trace.Tracer {
+	provider := o.provider
+	if provider == nil {
+		provider = TracerProviderFromContext(ctx)
+	}
+	return provider.Tracer(TracerName)
+}
+
+type tracerProviderKey struct{}
+
+// ContextWithTracerProvider returns a copy of ctx carrying the tracer provider
+// used by the tracing middleware and interceptors built without WithTracerProvider.
+func ContextWithTracerProvider(ctx context.Context, provider trace.TracerProvider) context.Context {
+	return context.WithValue(ctx, tracerProviderKey{}, provider)
+}
+
+// TracerProviderFromContext returns the tracer provider carried by ctx, or the
+// global OpenTelemetry tracer provider.
+func TracerProviderFromContext(ctx context.Context) trace.TracerProvider {
+	if provider, ok := ctx.Value(tracerProviderKey{}).(trace.TracerProvider); ok {
+		return provider
+	}
+	return otel.GetTracerProvider()
+}
+
+// withSpan records the span as the trace context of ctx, so the request-scoped
+// logger and the outbound clients of the correlation package refer to it.
+func withSpan(ctx context.Context, span trace.Span) context.Context {
+	sc := span.SpanContext()
+	if !span.IsRecording() || !sc.IsValid() {
+		return ctx
+	}
+
+	return correlation.WithTraceParent(ctx, correlation.TraceParent{
+		TraceID: [16]byte(sc.TraceID()),
+		SpanID:  [8]byte(sc.SpanID()),
+		Flags:   byte(sc.TraceFlags()),
+	})
+}
+
+// TracingHandler returns a gin.HandlerFunc (middleware) creating a server span
+// per request, continuing the trace of the traceparent header. Spans are named
+// after the method and the gin route and are recorded by the provider given
+// with WithTracerProvider, the provider of the request context (set by
+// kit.Server, see kit.Config TraceExporter) or the global OpenTelemetry tracer
+// provider. It should be used after RequestIDHandler.
+func TracingHandler(opts ...TracingOption) gin.HandlerFunc {
+	o := newTracingOptions(opts)
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx := tracePropagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := o.tracer(ctx).Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", c.FullPath()),
+				attribute.String("url.path", c.Request.URL.Path),
+				attribute.String("client.address", c.ClientIP()),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(withSpan(ctx, span))
+		c.Next()
+
+		code := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", code))
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+		if code >= 500 {
+			span.SetStatus(otelcodes.Error, c.Errors.String())
+		}
+	}
+}
+
+// metadataCarrier adapts incoming gRPC metadata to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startRPCSpan starts the server span of a call. Calls served in-process by the
+// gateway are children of the HTTP span; others continue the trace of the
+// traceparent metadata.
+func startRPCSpan(ctx context.Context, o tracingOptions, method string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			ctx = tracePropagator.Extract(ctx, metadataCarrier(md))
+		}
+	}
+
+	service, name := method, method
+	if parts := strings.SplitN(strings.TrimPrefix(method, "/"), "/", 2); len(parts) == 2 {
+		service, name = parts[0], parts[1]
+	}
+
+	ctx, span := o.tracer(ctx).Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", name),
+		),
+	)
+
+	return withSpan(ctx, span), span
+}
+
+func endRPCSpan(span trace.Span, err error) {
+	st := status.Convert(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(st.Code())))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, st.Message())
+	}
+
+	span.End()
+}
+
+// TracingUnaryInterceptor returns a grpc.UnaryServerInterceptor creating a server
+// span per call, continuing the trace of the traceparent metadata. Spans are
+// recorded as by TracingHandler.
+func TracingUnaryInterceptor(opts ...TracingOption) grpc.UnaryServerInterceptor {
+	o := newTracingOptions(opts)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startRPCSpan(ctx, o, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endRPCSpan(span, err)
+		return resp, err
+	}
+}
+
+// TracingStreamInterceptor is the streaming counterpart of TracingUnaryInterceptor.
+func TracingStreamInterceptor(opts ...TracingOption) grpc.StreamServerInterceptor {
+	o := newTracingOptions(opts)
+
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startRPCSpan(stream.Context(), o, info.FullMethod)
+
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		err := handler(srv, wrapped)
+		endRPCSpan(span, err)
+		return err
+	}
+}
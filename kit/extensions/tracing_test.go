@@ -0,0 +1,71 @@
+package extensions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestTracingHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := useSpanRecorder(t)
+
+	var traceParent correlation.TraceParent
+	router := gin.New()
+	router.Use(RequestIDHandler(), TracingHandler())
+	router.GET("/users/:id", func(c *gin.Context) {
+		traceParent, _ = correlation.TraceParentFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("Traceparent", testTraceParent)
+	router.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "GET /users/:id", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+
+	// logs and outbound calls refer to the server span.
+	assert.Equal(t, span.SpanContext().SpanID().String(), traceParent.SpanIDString())
+}
+
+func TestTracingUnaryInterceptor(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(correlation.TraceParentMetadataKey, testTraceParent))
+	_, err := TracingUnaryInterceptor()(ctx, nil, testInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, NewProblem(http.StatusNotFound, "not found")
+	})
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "test.Service/Method", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "Error", spans[0].Status().Code.String())
+}
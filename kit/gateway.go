@@ -0,0 +1,576 @@
+package kit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// GatewayBinding maps a unary gRPC method onto an HTTP/JSON route.
+//
+// Path uses the google.api.http template syntax (eg. /v1/users/{name}).
+// Body names the request field populated from the JSON body: "*" for the whole
+// request message, a field name, or empty when the route has no body. Fields not
+// bound by the path or the body are populated from the query string.
+type GatewayBinding struct {
+	RPC    string
+	Method string
+	Path   string
+	Body   string
+}
+
+type pathParam struct {
+	name  string
+	field string
+}
+
+// DefaultGatewayHeaders are the HTTP headers forwarded as gRPC metadata by
+// default: credentials for the JWT interceptors, request and trace context.
+// Cookies and hop-by-hop headers are not forwarded.
+var DefaultGatewayHeaders = []string{
+	"Authorization",
+	"Accept-Language",
+	"User-Agent",
+	correlation.RequestIDHeader,
+	correlation.TraceParentHeader,
+	"Tracestate",
+}
+
+// gatewayMetadataPrefix marks the HTTP headers forwarded as gRPC metadata
+// without their prefix, as grpc-gateway does.
+const gatewayMetadataPrefix = "Grpc-Metadata-"
+
+const defaultGatewayMaxBodyBytes = 4 << 20
+
+var (
+	gatewayMarshaler   = &jsonpb.Marshaler{EmitDefaults: true}
+	gatewayUnmarshaler = &jsonpb.Unmarshaler{AllowUnknownFields: true}
+)
+
+// gatewayCollector collects the routes registered by RegisterGateway while a
+// server builds the HTTP handlers of its services, so the server can describe
+// them in its OpenAPI document. Routes registered outside are not recorded.
+var gatewayCollector struct {
+	build sync.Mutex
+
+	mu     sync.Mutex
+	routes map[string]gatewayRoutes
+}
+
+// collectGateways calls build and returns the gateway routes it registered,
+// by service name. Builds are serialized.
+func collectGateways(build func()) map[string]gatewayRoutes {
+	gatewayCollector.build.Lock()
+	defer gatewayCollector.build.Unlock()
+
+	routes := map[string]gatewayRoutes{}
+	gatewayCollector.mu.Lock()
+	gatewayCollector.routes = routes
+	gatewayCollector.mu.Unlock()
+
+	defer func() {
+		gatewayCollector.mu.Lock()
+		gatewayCollector.routes = nil
+		gatewayCollector.mu.Unlock()
+	}()
+
+	build()
+	return routes
+}
+
+func recordGateway(service string, routes gatewayRoutes) {
+	gatewayCollector.mu.Lock()
+	defer gatewayCollector.mu.Unlock()
+
+	if gatewayCollector.routes != nil {
+		gatewayCollector.routes[service] = routes
+	}
+}
+
+// gatewayRoutes are the bindings registered for a service, relative to the
+// base path of the router.
+type gatewayRoutes struct {
+	base     string
+	bindings []GatewayBinding
+}
+
+// RegisterGateway derives HTTP/JSON routes from the service RPCServiceDesc()
+// and registers them with the given router. Calls are dispatched in-process
+// through the same interceptor chain the gRPC server uses.
+//
+// Routes are taken, in order of precedence, from the given bindings, from the
+// google.api.http annotations of the proto definition and otherwise default to
+// POST /{package.Service}/{Method} with the request message as JSON body.
+//
+// Request bodies are bounded by Config GatewayMaxBodyBytes, and only the
+// headers listed in Config GatewayHeaders, or prefixed with Grpc-Metadata-,
+// are forwarded as gRPC metadata. Query parameters are converted to the type
+// of the request fields described by the proto definition.
+func RegisterGateway(r gin.IRoutes, svc Service, bindings ...GatewayBinding) error {
+	desc := svc.RPCServiceDesc()
+	if desc == nil {
+		return errors.New("service does not provide a gRPC service description")
+	}
+
+	rules, err := gatewayRules(desc)
+	if err != nil {
+		return err
+	}
+
+	explicit := map[string][]GatewayBinding{}
+	for _, b := range bindings {
+		explicit[b.RPC] = append(explicit[b.RPC], b)
+	}
+	for rpc, b := range explicit {
+		rules[rpc] = b
+	}
+
+	cfg := svc.Config()
+	logger, err := NewLoggerWithOptions(WithLoggerConfig(cfg))
+	if err != nil {
+		return err
+	}
+	unary, _ := rpcInterceptors(cfg, svc, logger, nil)
+	interceptor := grpc_middleware.ChainUnaryServer(unary...)
+
+	inputs, fields, err := gatewayInputs(desc)
+	if err != nil {
+		return err
+	}
+
+	opts := gatewayOptions{
+		maxBodyBytes: cfg.GatewayMaxBodyBytes,
+		headers:      map[string]bool{},
+	}
+	if opts.maxBodyBytes <= 0 {
+		opts.maxBodyBytes = defaultGatewayMaxBodyBytes
+	}
+	headers := cfg.GatewayHeaders
+	if headers == nil {
+		headers = DefaultGatewayHeaders
+	}
+	for _, h := range headers {
+		opts.headers[http.CanonicalHeaderKey(h)] = true
+	}
+
+	registered := gatewayRoutes{base: "/"}
+	if g, ok := r.(interface{ BasePath() string }); ok {
+		registered.base = g.BasePath()
+	}
+
+	for _, method := range desc.Methods {
+		routes, ok := rules[method.MethodName]
+		if !ok {
+			routes = []GatewayBinding{{
+				RPC:    method.MethodName,
+				Method: http.MethodPost,
+				Path:   "/" + desc.ServiceName + "/" + method.MethodName,
+				Body:   "*",
+			}}
+		}
+
+		for _, route := range routes {
+			path, params, err := ginPath(route.Path)
+			if err != nil {
+				return errors.Wrapf(err, "unable to bind %s.%s", desc.ServiceName, method.MethodName)
+			}
+
+			fullMethod := "/" + desc.ServiceName + "/" + method.MethodName
+			input := inputs[method.MethodName]
+			field := func(path string) *descriptor.FieldDescriptorProto {
+				return fields.field(input, path)
+			}
+			r.Handle(route.Method, path, gatewayHandler(svc, fullMethod, method, route, params, field, opts, interceptor))
+			registered.bindings = append(registered.bindings, route)
+		}
+	}
+
+	recordGateway(desc.ServiceName, registered)
+	return nil
+}
+
+// gatewayOptions are the request limits of the gateway routes of a service.
+type gatewayOptions struct {
+	maxBodyBytes int64
+	headers      map[string]bool
+}
+
+// gatewayInputs returns the request message of the service methods, by
+// method name, and the index of the messages of the proto definition.
+func gatewayInputs(desc *grpc.ServiceDesc) (map[string]string, *protoSchemas, error) {
+	inputs := map[string]string{}
+	fields := &protoSchemas{
+		messages: map[string]*descriptor.DescriptorProto{},
+		enums:    map[string]*descriptor.EnumDescriptorProto{},
+		files:    map[string]bool{},
+	}
+
+	file, ok := desc.Metadata.(string)
+	if !ok {
+		return inputs, fields, nil
+	}
+
+	fd, err := fields.index(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, sd := range fd.GetService() {
+		if fullName(fd.GetPackage(), sd.GetName()) != desc.ServiceName {
+			continue
+		}
+		for _, md := range sd.GetMethod() {
+			inputs[md.GetName()] = md.GetInputType()
+		}
+	}
+
+	return inputs, fields, nil
+}
+
+func gatewayHandler(svc Service, fullMethod string, method grpc.MethodDesc, route GatewayBinding, params []pathParam, field func(string) *descriptor.FieldDescriptorProto, opts gatewayOptions, interceptor grpc.UnaryServerInterceptor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, opts.maxBodyBytes)
+		}
+
+		data, err := gatewayRequest(c, route, params, field)
+		if _, ok := errors.Cause(err).(*http.MaxBytesError); ok {
+			extensions.AbortWithStatusJSON(c, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		if err != nil {
+			extensions.AbortWithStatusJSON(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		dec := func(v interface{}) error {
+			return gatewayUnmarshaler.Unmarshal(bytes.NewReader(data), v.(proto.Message))
+		}
+
+		stream := &gatewayStream{method: fullMethod}
+		ctx := metadata.NewIncomingContext(c.Request.Context(), gatewayMetadata(c.Request, opts.headers))
+		ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+		resp, err := method.Handler(svc, ctx, dec, interceptor)
+		stream.writeHeader(c.Writer.Header())
+		if err != nil {
+			extensions.AbortWithError(c, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := gatewayMarshaler.Marshal(&buf, resp.(proto.Message)); err != nil {
+			extensions.AbortWithStatusJSON(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Data(http.StatusOK, "application/json; charset=utf-8", buf.Bytes())
+	}
+}
+
+// gatewayStream collects the headers set by the interceptors and the handler
+// of calls served by the gateway, so they can be sent as HTTP headers.
+// Trailers are dropped.
+type gatewayStream struct {
+	method string
+
+	mu     sync.Mutex
+	header metadata.MD
+}
+
+func (s *gatewayStream) Method() string {
+	return s.method
+}
+
+func (s *gatewayStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *gatewayStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *gatewayStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func (s *gatewayStream) writeHeader(h http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, values := range s.header {
+		h.Del(key)
+		for _, v := range values {
+			h.Add(key, v)
+		}
+	}
+}
+
+// gatewayRequest merges the body, query string and path parameters into the
+// JSON representation of the request message. field returns the descriptor
+// of the request field at a dotted path, or nil when it is unknown.
+func gatewayRequest(c *gin.Context, route GatewayBinding, params []pathParam, field func(string) *descriptor.FieldDescriptorProto) ([]byte, error) {
+	fields := map[string]interface{}{}
+
+	if route.Body != "" && c.Request.Body != nil {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(body)) > 0 {
+			if route.Body == "*" {
+				err = json.Unmarshal(body, &fields)
+			} else {
+				var v interface{}
+				err = json.Unmarshal(body, &v)
+				setField(fields, route.Body, v)
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid request body")
+			}
+		}
+	}
+
+	if route.Body != "*" {
+		for key, values := range c.Request.URL.Query() {
+			setField(fields, key, queryValue(field(key), values))
+		}
+	}
+
+	for _, p := range params {
+		setField(fields, p.field, strings.TrimPrefix(c.Param(p.name), "/"))
+	}
+
+	return json.Marshal(fields)
+}
+
+// setField sets the value at the dotted field path, creating nested objects as needed.
+func setField(fields map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := fields[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			fields[part] = next
+		}
+		fields = next
+	}
+	fields[parts[len(parts)-1]] = value
+}
+
+// queryValue converts the values of a query parameter to the JSON mapping of
+// the field: booleans, enum numbers and lists of repeated fields. Other values
+// stay strings, which the JSON mapping accepts for numbers.
+func queryValue(f *descriptor.FieldDescriptorProto, values []string) interface{} {
+	if f == nil {
+		if len(values) == 1 {
+			return values[0]
+		}
+		return values
+	}
+
+	converted := make([]interface{}, len(values))
+	for i, v := range values {
+		converted[i] = v
+		switch f.GetType() {
+		case descriptor.FieldDescriptorProto_TYPE_BOOL:
+			if b, err := strconv.ParseBool(v); err == nil {
+				converted[i] = b
+			}
+		case descriptor.FieldDescriptorProto_TYPE_ENUM:
+			if n, err := strconv.Atoi(v); err == nil {
+				converted[i] = n
+			}
+		}
+	}
+
+	if f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED || len(converted) > 1 {
+		return converted
+	}
+	return converted[0]
+}
+
+// gatewayMetadata forwards the allowed headers, and the headers prefixed with
+// Grpc-Metadata- without their prefix.
+func gatewayMetadata(r *http.Request, allowed map[string]bool) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		switch {
+		case allowed[key]:
+			md.Append(strings.ToLower(key), values...)
+		case strings.HasPrefix(key, gatewayMetadataPrefix) && len(key) > len(gatewayMetadataPrefix):
+			md.Append(strings.ToLower(strings.TrimPrefix(key, gatewayMetadataPrefix)), values...)
+		}
+	}
+
+	if addr := r.RemoteAddr; addr != "" {
+		md.Append("x-forwarded-for", addr)
+	}
+
+	return md
+}
+
+// ginPath converts a google.api.http path template into a gin route.
+func ginPath(template string) (string, []pathParam, error) {
+	if !strings.HasPrefix(template, "/") {
+		return "", nil, errors.Errorf("path template must start with /: %s", template)
+	}
+
+	var params []pathParam
+	segments := strings.Split(template[1:], "/")
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") {
+			if strings.ContainsAny(seg, ":*{}") {
+				return "", nil, errors.Errorf("unsupported path segment %q in %s", seg, template)
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(seg, "}") {
+			return "", nil, errors.Errorf("unsupported path segment %q in %s", seg, template)
+		}
+
+		field, pattern := seg[1:len(seg)-1], "*"
+		if idx := strings.Index(field, "="); idx >= 0 {
+			field, pattern = field[:idx], field[idx+1:]
+		}
+
+		name := strings.Replace(field, ".", "_", -1)
+		switch {
+		case pattern == "*":
+			segments[i] = ":" + name
+		case pattern == "**" && i == len(segments)-1:
+			segments[i] = "*" + name
+		default:
+			return "", nil, errors.Errorf("unsupported path pattern %q in %s", pattern, template)
+		}
+
+		params = append(params, pathParam{name: name, field: field})
+	}
+
+	return "/" + strings.Join(segments, "/"), params, nil
+}
+
+// gatewayRules reads the google.api.http annotations of the service methods
+// from the registered proto file descriptor.
+func gatewayRules(desc *grpc.ServiceDesc) (map[string][]GatewayBinding, error) {
+	rules := map[string][]GatewayBinding{}
+
+	file, ok := desc.Metadata.(string)
+	if !ok {
+		return rules, nil
+	}
+
+	fd, err := fileDescriptor(file)
+	if err != nil || fd == nil {
+		return rules, err
+	}
+
+	for _, sd := range fd.GetService() {
+		if fullName(fd.GetPackage(), sd.GetName()) != desc.ServiceName {
+			continue
+		}
+
+		for _, md := range sd.GetMethod() {
+			if md.GetOptions() == nil || !proto.HasExtension(md.GetOptions(), annotations.E_Http) {
+				continue
+			}
+
+			ext, err := proto.GetExtension(md.GetOptions(), annotations.E_Http)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid google.api.http annotation on %s", md.GetName())
+			}
+
+			rule := ext.(*annotations.HttpRule)
+			for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+				if b, ok := httpRuleBinding(md.GetName(), r); ok {
+					rules[md.GetName()] = append(rules[md.GetName()], b)
+				}
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+func httpRuleBinding(rpc string, rule *annotations.HttpRule) (GatewayBinding, bool) {
+	b := GatewayBinding{RPC: rpc, Body: rule.GetBody()}
+	switch {
+	case rule.GetGet() != "":
+		b.Method, b.Path = http.MethodGet, rule.GetGet()
+	case rule.GetPut() != "":
+		b.Method, b.Path = http.MethodPut, rule.GetPut()
+	case rule.GetPost() != "":
+		b.Method, b.Path = http.MethodPost, rule.GetPost()
+	case rule.GetDelete() != "":
+		b.Method, b.Path = http.MethodDelete, rule.GetDelete()
+	case rule.GetPatch() != "":
+		b.Method, b.Path = http.MethodPatch, rule.GetPatch()
+	case rule.GetCustom() != nil:
+		b.Method, b.Path = rule.GetCustom().GetKind(), rule.GetCustom().GetPath()
+	default:
+		return b, false
+	}
+
+	return b, true
+}
+
+func fileDescriptor(file string) (*descriptor.FileDescriptorProto, error) {
+	gz := proto.FileDescriptor(file)
+	if gz == nil {
+		return nil, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid file descriptor for %s", file)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid file descriptor for %s", file)
+	}
+
+	fd := &descriptor.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		return nil, errors.Wrapf(err, "invalid file descriptor for %s", file)
+	}
+
+	return fd, nil
+}
+
+func fullName(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// HTTPStatusFromCode converts a gRPC status code into the corresponding HTTP status code.
+//
+// Deprecated: use extensions.HTTPStatusFromCode.
+func HTTPStatusFromCode(code codes.Code) int {
+	return extensions.HTTPStatusFromCode(code)
+}
@@ -0,0 +1,295 @@
+package kit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/insighted4/insighted-go/eventsourcing"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGinPath(t *testing.T) {
+	testCases := map[string]struct {
+		Template string
+		Path     string
+		Params   []pathParam
+		Err      bool
+	}{
+		"static": {
+			Template: "/v1/users",
+			Path:     "/v1/users",
+		},
+		"param": {
+			Template: "/v1/users/{name}",
+			Path:     "/v1/users/:name",
+			Params:   []pathParam{{name: "name", field: "name"}},
+		},
+		"nested field": {
+			Template: "/v1/users/{user.name=*}",
+			Path:     "/v1/users/:user_name",
+			Params:   []pathParam{{name: "user_name", field: "user.name"}},
+		},
+		"catch all": {
+			Template: "/v1/files/{path=**}",
+			Path:     "/v1/files/*path",
+			Params:   []pathParam{{name: "path", field: "path"}},
+		},
+		"relative": {
+			Template: "v1/users",
+			Err:      true,
+		},
+		"custom verb": {
+			Template: "/v1/users/{name}:cancel",
+			Err:      true,
+		},
+		"complex pattern": {
+			Template: "/v1/{name=users/*}",
+			Err:      true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			path, params, err := ginPath(tc.Template)
+			if tc.Err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Path, path)
+			assert.Equal(t, tc.Params, params)
+		})
+	}
+}
+
+func TestSetField(t *testing.T) {
+	fields := map[string]interface{}{}
+	setField(fields, "name", "octocat")
+	setField(fields, "user.id", "1")
+	setField(fields, "user.login", "octocat")
+
+	assert.Equal(t, map[string]interface{}{
+		"name": "octocat",
+		"user": map[string]interface{}{
+			"id":    "1",
+			"login": "octocat",
+		},
+	}, fields)
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatusFromCode(codes.OK))
+	assert.Equal(t, http.StatusBadRequest, HTTPStatusFromCode(codes.InvalidArgument))
+	assert.Equal(t, http.StatusNotFound, HTTPStatusFromCode(codes.NotFound))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusFromCode(codes.Unauthenticated))
+	assert.Equal(t, http.StatusForbidden, HTTPStatusFromCode(codes.PermissionDenied))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatusFromCode(codes.Unknown))
+}
+
+// gatewayMethod builds a grpc.MethodDesc the way protoc-gen-go does, for
+// handlers taking and returning a structpb.Struct.
+func gatewayMethod(name string, fn func(context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(structpb.Struct)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(ctx, req.(*structpb.Struct))
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Gateway/" + name}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+func TestRegisterGateway(t *testing.T) {
+	svc := newTestService("")
+	svc.desc = &grpc.ServiceDesc{
+		ServiceName: "test.Gateway",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			gatewayMethod("Echo", func(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				return req, nil
+			}),
+			gatewayMethod("Fail", func(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				switch name := req.Fields["name"].GetStringValue(); name {
+				case "aggregate":
+					return nil, eventsourcing.NewError(nil, eventsourcing.ErrorAggregateNotFound, "order not found")
+				case "internal":
+					return nil, errors.New("database password is hunter2")
+				default:
+					code, _ := strconv.Atoi(name)
+					return nil, status.Error(codes.Code(code), "failed")
+				}
+			}),
+			gatewayMethod("Default", func(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				return req, nil
+			}),
+			gatewayMethod("Metadata", func(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				resp := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+				for key, values := range md {
+					resp.Fields[key] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: values[0]}}
+				}
+				return resp, nil
+			}),
+		},
+	}
+	svc.cfg.GatewayMaxBodyBytes = 1024
+
+	router := gin.New()
+	err := RegisterGateway(router, svc,
+		GatewayBinding{RPC: "Echo", Method: http.MethodGet, Path: "/v1/users/{user.name}"},
+		GatewayBinding{RPC: "Echo", Method: http.MethodPost, Path: "/v1/users/{name}", Body: "*"},
+		GatewayBinding{RPC: "Echo", Method: http.MethodPatch, Path: "/v1/users/{name}", Body: "user"},
+		GatewayBinding{RPC: "Fail", Method: http.MethodGet, Path: "/v1/errors/{name}"},
+	)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		Method string
+		Target string
+		Body   string
+		Status int
+		Resp   string
+	}{
+		"path and query": {
+			http.MethodGet, "/v1/users/octocat?page=2&tag=a&tag=b", "",
+			http.StatusOK, `{"user": {"name": "octocat"}, "page": "2", "tag": ["a", "b"]}`,
+		},
+		"whole body": {
+			http.MethodPost, "/v1/users/octocat?page=2", `{"email": "octocat@github.com"}`,
+			http.StatusOK, `{"name": "octocat", "email": "octocat@github.com"}`,
+		},
+		"body field": {
+			http.MethodPatch, "/v1/users/octocat?page=2", `{"email": "octocat@github.com"}`,
+			http.StatusOK, `{"name": "octocat", "page": "2", "user": {"email": "octocat@github.com"}}`,
+		},
+		"default route": {
+			http.MethodPost, "/test.Gateway/Default", `{"name": "octocat"}`,
+			http.StatusOK, `{"name": "octocat"}`,
+		},
+		"invalid body": {
+			http.MethodPost, "/v1/users/octocat", `{"email"`,
+			http.StatusBadRequest, "",
+		},
+		"body too large": {
+			http.MethodPost, "/v1/users/octocat", `{"email": "` + strings.Repeat("a", 1024) + `"}`,
+			http.StatusRequestEntityTooLarge, "",
+		},
+		"not found": {
+			http.MethodGet, "/v1/errors/" + strconv.Itoa(int(codes.NotFound)), "",
+			http.StatusNotFound, `{"title": "Not Found", "status": 404, "detail": "failed", "instance": "/v1/errors/5"}`,
+		},
+		"invalid argument": {
+			http.MethodGet, "/v1/errors/" + strconv.Itoa(int(codes.InvalidArgument)), "",
+			http.StatusBadRequest, "",
+		},
+		"unavailable": {
+			http.MethodGet, "/v1/errors/" + strconv.Itoa(int(codes.Unavailable)), "",
+			http.StatusServiceUnavailable, "",
+		},
+		"mapped error": {
+			http.MethodGet, "/v1/errors/aggregate", "",
+			http.StatusNotFound, `{"title": "Not Found", "status": 404, "detail": "order not found", "instance": "/v1/errors/aggregate"}`,
+		},
+		"internal error": {
+			http.MethodGet, "/v1/errors/internal", "",
+			http.StatusInternalServerError, "",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.Method, tc.Target, strings.NewReader(tc.Body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Status, w.Code)
+			if tc.Status != http.StatusOK {
+				assert.Equal(t, extensions.ProblemContentType, w.Header().Get("Content-Type"))
+				assert.NotContains(t, w.Body.String(), "hunter2")
+			}
+			if tc.Resp != "" {
+				assert.JSONEq(t, tc.Resp, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/test.Gateway/Metadata", strings.NewReader("{}"))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("Connection", "keep-alive")
+		req.Header.Set("Grpc-Metadata-Tenant", "acme")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var md map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &md))
+		assert.Equal(t, "Bearer token", md["authorization"])
+		assert.Equal(t, "acme", md["tenant"])
+		assert.NotContains(t, md, "cookie")
+		assert.NotContains(t, md, "connection")
+		assert.NotContains(t, md, "grpc-metadata-tenant")
+	})
+
+	// routes registered outside of a server are not recorded.
+	assert.Empty(t, collectGateways(func() {}))
+	routes := collectGateways(func() {
+		assert.NoError(t, RegisterGateway(gin.New(), svc))
+	})
+	assert.Len(t, routes["test.Gateway"].bindings, 4)
+}
+
+func TestQueryValue(t *testing.T) {
+	field := func(typ descriptor.FieldDescriptorProto_Type, label descriptor.FieldDescriptorProto_Label) *descriptor.FieldDescriptorProto {
+		return &descriptor.FieldDescriptorProto{Type: typ.Enum(), Label: label.Enum()}
+	}
+	optional, repeated := descriptor.FieldDescriptorProto_LABEL_OPTIONAL, descriptor.FieldDescriptorProto_LABEL_REPEATED
+
+	testCases := map[string]struct {
+		Field  *descriptor.FieldDescriptorProto
+		Values []string
+		Value  interface{}
+	}{
+		"unknown":         {nil, []string{"1"}, "1"},
+		"unknown list":    {nil, []string{"1", "2"}, []string{"1", "2"}},
+		"bool":            {field(descriptor.FieldDescriptorProto_TYPE_BOOL, optional), []string{"true"}, true},
+		"invalid bool":    {field(descriptor.FieldDescriptorProto_TYPE_BOOL, optional), []string{"yes"}, "yes"},
+		"number":          {field(descriptor.FieldDescriptorProto_TYPE_INT32, optional), []string{"42"}, "42"},
+		"enum number":     {field(descriptor.FieldDescriptorProto_TYPE_ENUM, optional), []string{"1"}, 1},
+		"enum name":       {field(descriptor.FieldDescriptorProto_TYPE_ENUM, optional), []string{"ACTIVE"}, "ACTIVE"},
+		"repeated single": {field(descriptor.FieldDescriptorProto_TYPE_STRING, repeated), []string{"a"}, []interface{}{"a"}},
+		"repeated bool":   {field(descriptor.FieldDescriptorProto_TYPE_BOOL, repeated), []string{"true", "false"}, []interface{}{true, false}},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			assert.Equal(t, tc.Value, queryValue(tc.Field, tc.Values))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package kit
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// listenFDsStart is the first inherited file descriptor, after stdin, stdout and stderr.
+	listenFDsStart = 3
+
+	// handoffEnv carries the number of listeners passed to a re-executed process.
+	handoffEnv = "KIT_LISTEN_FDS"
+
+	// handoffReadyEnv carries the file descriptor a re-executed process reports
+	// it is serving on.
+	handoffReadyEnv = "KIT_HANDOFF_READY"
+)
+
+// handoffTimeout bounds how long a process waits for the one it handed its
+// listeners off to to report it is serving.
+var handoffTimeout = time.Minute
+
+var (
+	inheritOnce sync.Once
+	inheritMu   sync.Mutex
+	inherited   []net.Listener
+	inheritErr  error
+	readyFile   *os.File
+)
+
+// inheritedListeners loads the listeners passed by the parent process, either
+// through systemd socket activation (LISTEN_PID and LISTEN_FDS) or through a
+// re-exec triggered by SIGUSR2 (KIT_LISTEN_FDS). The variables are unset so they
+// do not leak to child processes.
+func inheritedListeners() error {
+	inheritOnce.Do(func() {
+		count := 0
+		if n := os.Getenv(handoffEnv); n != "" {
+			count, inheritErr = strconv.Atoi(n)
+			if fd, err := strconv.Atoi(os.Getenv(handoffReadyEnv)); err == nil {
+				readyFile = os.NewFile(uintptr(fd), "handoff-ready")
+			}
+		} else if pid := os.Getenv("LISTEN_PID"); pid != "" && pid == strconv.Itoa(os.Getpid()) {
+			count, inheritErr = strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		}
+
+		for _, key := range []string{handoffEnv, handoffReadyEnv, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			os.Unsetenv(key)
+		}
+
+		if inheritErr != nil {
+			inheritErr = errors.Wrap(inheritErr, "invalid inherited listeners count")
+			return
+		}
+
+		for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+			file := os.NewFile(uintptr(fd), "listener-"+strconv.Itoa(fd))
+			lis, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				inheritErr = errors.Wrapf(err, "unable to inherit listener from file descriptor %d", fd)
+				return
+			}
+
+			inherited = append(inherited, lis)
+		}
+	})
+
+	return inheritErr
+}
+
+// notifyHandoffReady reports to the process that handed its listeners off to
+// this one, if any, that the servers are up: it starts draining then.
+func notifyHandoffReady() error {
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+
+	if readyFile == nil {
+		return nil
+	}
+
+	_, err := readyFile.Write([]byte{1})
+	readyFile.Close()
+	readyFile = nil
+	return errors.Wrap(err, "unable to report readiness to the parent process")
+}
+
+// takeInherited returns, and removes from the pool, the inherited listener
+// bound to the given unix socket path or, when socket is empty, TCP port.
+func takeInherited(port int, socket string) net.Listener {
+	if port == 0 && socket == "" {
+		return nil
+	}
+
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+
+	for i, lis := range inherited {
+		var match bool
+		switch addr := lis.Addr().(type) {
+		case *net.TCPAddr:
+			match = socket == "" && addr.Port == port
+		case *net.UnixAddr:
+			match = socket != "" && addr.Name == socket
+		}
+
+		if match {
+			inherited = append(inherited[:i], inherited[i+1:]...)
+			return lis
+		}
+	}
+
+	return nil
+}
+
+// listeners returns the listeners bound by the server.
+func (s *Server) listeners() []net.Listener {
+	var listeners []net.Listener
+	for _, lis := range []net.Listener{s.httpListener, s.rpcListener, s.adminListener} {
+		if lis != nil {
+			listeners = append(listeners, lis)
+		}
+	}
+	return listeners
+}
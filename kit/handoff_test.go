@@ -0,0 +1,25 @@
+package kit
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeInherited(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer lis.Close()
+
+	inheritMu.Lock()
+	inherited = append(inherited, lis)
+	inheritMu.Unlock()
+
+	port := lis.Addr().(*net.TCPAddr).Port
+	assert.Nil(t, takeInherited(0, ""))
+	assert.Nil(t, takeInherited(port+1, ""))
+	assert.Nil(t, takeInherited(port, "/tmp/kit.sock"))
+	assert.Equal(t, lis, takeInherited(port, ""))
+	assert.Nil(t, takeInherited(port, ""))
+}
@@ -0,0 +1,105 @@
+//go:build !windows
+// +build !windows
+
+package kit
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// handoffSignals are the signals triggering a listener handoff.
+var handoffSignals = []os.Signal{syscall.SIGUSR2}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// handoff starts a new instance of the running binary, passing it the given
+// listeners so it can take over while this process drains. It returns once the
+// new process reports it is serving, and fails when the process exits or does
+// not report within handoffTimeout: this process keeps serving then.
+func handoff(listeners []net.Listener) (*os.Process, error) {
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, lis := range listeners {
+		fl, ok := lis.(filer)
+		if !ok {
+			return nil, errors.Errorf("listener %s cannot be handed off", lis.Addr())
+		}
+
+		// the socket file must outlive this process' listener.
+		if ul, ok := lis.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+
+		f, err := fl.File()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to hand off listener %s", lis.Addr())
+		}
+		files = append(files, f)
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to locate executable")
+	}
+
+	// the new process writes to the pipe once serving; reads fail with
+	// io.EOF when it exits before.
+	ready, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create readiness pipe")
+	}
+	defer ready.Close()
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, handoffEnv+"=") && !strings.HasPrefix(kv, handoffReadyEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(env,
+		handoffEnv+"="+strconv.Itoa(len(files)),
+		handoffReadyEnv+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w)
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to start new process")
+	}
+
+	ready.SetReadDeadline(time.Now().Add(handoffTimeout))
+	if _, err := ready.Read(make([]byte, 1)); err != nil {
+		if err != io.EOF {
+			cmd.Process.Kill()
+			err = errors.Wrap(err, "new process did not report ready")
+		} else {
+			err = errors.New("new process exited before reporting ready")
+		}
+		cmd.Wait()
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
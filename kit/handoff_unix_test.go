@@ -0,0 +1,107 @@
+//go:build !windows
+// +build !windows
+
+package kit
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// handoffChildEnv makes TestHandoffChild act as the process taking over.
+const handoffChildEnv = "KIT_TEST_HANDOFF_CHILD"
+
+// TestHandoffChild is run by TestHandoff in the re-executed test binary: it
+// serves the inherited listener, answering its pid to a single connection.
+func TestHandoffChild(t *testing.T) {
+	mode := os.Getenv(handoffChildEnv)
+	if mode == "" {
+		t.Skip("run by TestHandoff")
+	}
+	if mode == "fail" {
+		os.Exit(1)
+	}
+
+	if err := inheritedListeners(); err != nil {
+		os.Exit(2)
+	}
+	port, _ := strconv.Atoi(mode)
+	lis := takeInherited(port, "")
+	if lis == nil {
+		os.Exit(3)
+	}
+	if err := notifyHandoffReady(); err != nil {
+		os.Exit(4)
+	}
+
+	conn, err := lis.Accept()
+	if err != nil {
+		os.Exit(5)
+	}
+	conn.Write([]byte(strconv.Itoa(os.Getpid()) + "\n"))
+	conn.Close()
+	os.Exit(0)
+}
+
+func TestHandoff(t *testing.T) {
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestHandoffChild$"}
+	defer func() { os.Args = args }()
+
+	testCases := map[string]struct {
+		Fail    bool
+		Timeout time.Duration
+		Err     string
+	}{
+		"ready":         {false, time.Minute, ""},
+		"failed init":   {true, time.Minute, "exited before reporting ready"},
+		"never started": {false, time.Nanosecond, "did not report ready"},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			timeout := handoffTimeout
+			handoffTimeout = tc.Timeout
+			defer func() { handoffTimeout = timeout }()
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer lis.Close()
+
+			mode := strconv.Itoa(lis.Addr().(*net.TCPAddr).Port)
+			if tc.Fail {
+				mode = "fail"
+			}
+			os.Setenv(handoffChildEnv, mode)
+			defer os.Unsetenv(handoffChildEnv)
+
+			proc, err := handoff([]net.Listener{lis})
+			if tc.Err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.Err)
+				return
+			}
+			assert.NoError(t, err)
+
+			// the listener is served by the new process once this one closes it.
+			lis.Close()
+			conn, err := net.Dial("tcp", lis.Addr().String())
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, strconv.Itoa(proc.Pid)+"\n", line)
+
+			state, err := proc.Wait()
+			assert.NoError(t, err)
+			assert.True(t, state.Success())
+		})
+	}
+}
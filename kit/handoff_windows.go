@@ -0,0 +1,15 @@
+package kit
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// handoffSignals are the signals triggering a listener handoff. There is none on Windows.
+var handoffSignals []os.Signal
+
+func handoff(listeners []net.Listener) (*os.Process, error) {
+	return nil, errors.New("listener handoff is not supported on windows")
+}
@@ -0,0 +1,293 @@
+/*
+Package kittest provides utilities to test kit services in-process.
+
+A Server boots a kit.Service on ephemeral loopback ports, so tests can run in
+parallel without colliding, and tears it down through the regular graceful
+shutdown path:
+
+	srv := kittest.New(t, svc)
+	res, err := http.Get(srv.URL + "/")
+	client := api.NewGithubProxyClient(srv.Conn)
+*/
+package kittest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/insighted4/insighted-go/kit"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1 << 20
+
+// Server is a kit.Server listening on ephemeral ports.
+type Server struct {
+	*kit.Server
+
+	// URL is the base URL of the HTTP listener, eg. http://127.0.0.1:50412.
+	URL string
+
+	// Client is an HTTP client able to reach URL and AdminURL, including
+	// when the server listens on unix domain sockets.
+	Client *http.Client
+
+	// AdminURL is the base URL of the admin listener. It is empty when
+	// the admin listener is disabled.
+	AdminURL string
+
+	// Conn is a gRPC client connection to the service, using TLS when the
+	// service serves it. It is nil when the service has no gRPC representation.
+	Conn *grpc.ClientConn
+
+	bufconn *bufconn.Listener
+	dir     string
+	tls     *tls.Config
+}
+
+type options struct {
+	bufconn bool
+	sockets bool
+	tls     *tls.Config
+}
+
+// Option configures a Server.
+type Option func(*options)
+
+// WithBufconn serves gRPC over an in-memory connection instead of a loopback port.
+func WithBufconn() Option {
+	return func(o *options) {
+		o.bufconn = true
+	}
+}
+
+// WithUnixSockets serves HTTP, gRPC and admin endpoints over unix domain
+// sockets in a temporary directory, avoiding port allocation altogether.
+func WithUnixSockets() Option {
+	return func(o *options) {
+		o.sockets = true
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of Client and Conn when the service
+// serves TLS, eg. to present a client certificate to a service requiring mutual
+// TLS. By default they trust the certificate of the service TLSCertFile, which
+// must then be valid for 127.0.0.1; set ServerName otherwise, eg. with WithBufconn.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tls = cfg
+	}
+}
+
+// New starts the service on ephemeral ports and registers its shutdown with
+// t.Cleanup. It fails the test if the server cannot be started.
+func New(t testing.TB, svc kit.Service, opts ...Option) *Server {
+	t.Helper()
+
+	s, err := NewServer(svc, opts...)
+	if err != nil {
+		t.Fatalf("unable to start kit server: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("unable to stop kit server: %v", err)
+		}
+	})
+
+	return s
+}
+
+// NewServer starts the service on ephemeral ports. Callers must call Close.
+func NewServer(svc kit.Service, opts ...Option) (*Server, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg := svc.Config()
+	s := &Server{Client: &http.Client{}}
+
+	if cfg.TLSEnabled() {
+		s.tls = o.tls
+		if s.tls == nil {
+			pool, err := certPool(cfg.TLSCertFile)
+			if err != nil {
+				return nil, err
+			}
+			s.tls = &tls.Config{RootCAs: pool}
+		}
+	}
+	transport := &http.Transport{TLSClientConfig: s.tls}
+	s.Client.Transport = transport
+
+	if o.sockets {
+		dir, err := ioutil.TempDir("", "kittest")
+		if err != nil {
+			return nil, err
+		}
+		s.dir = dir
+		transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", filepath.Join(dir, host))
+		}
+	}
+
+	var listeners []net.Listener
+	listen := func(name string) (net.Listener, error) {
+		var lis net.Listener
+		var err error
+		if o.sockets {
+			lis, err = net.Listen("unix", filepath.Join(s.dir, name+".sock"))
+		} else {
+			lis, err = net.Listen("tcp", "127.0.0.1:0")
+		}
+		if err == nil {
+			listeners = append(listeners, lis)
+		}
+		return lis, err
+	}
+	closeAll := func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+		if s.dir != "" {
+			os.RemoveAll(s.dir)
+		}
+	}
+
+	httpLis, err := listen("http")
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	serverOpts := []kit.Option{kit.WithHTTPListener(httpLis)}
+
+	if cfg.AdminPort != 0 {
+		adminLis, err := listen("admin")
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		serverOpts = append(serverOpts, kit.WithAdminListener(adminLis))
+	}
+
+	hasRPC := svc.RPCServiceDesc() != nil
+	if hasRPC && !cfg.SinglePort {
+		var rpcLis net.Listener
+		if o.bufconn {
+			s.bufconn = bufconn.Listen(bufSize)
+			rpcLis = s.bufconn
+		} else if rpcLis, err = listen("rpc"); err != nil {
+			closeAll()
+			return nil, err
+		}
+		serverOpts = append(serverOpts, kit.WithRPCListener(rpcLis))
+	}
+
+	s.Server = kit.New(svc, serverOpts...)
+	if err := s.Server.Start(); err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	s.URL = baseURL(s.HTTPAddr(), s.tls != nil)
+	if addr := s.AdminAddr(); addr != nil {
+		// the admin listener does not serve TLS.
+		s.AdminURL = baseURL(addr, false)
+	}
+
+	if hasRPC {
+		if s.Conn, err = s.dial(); err != nil {
+			s.Server.Stop()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Server) dial() (*grpc.ClientConn, error) {
+	creds := grpc.WithInsecure()
+	if s.tls != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(s.tls))
+	}
+
+	if s.bufconn != nil {
+		return grpc.Dial("bufnet", creds, grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return s.bufconn.Dial()
+		}))
+	}
+
+	addr := s.HTTPAddr()
+	if rpc := s.RPCAddr(); rpc != nil {
+		addr = rpc
+	}
+
+	if addr.Network() == "unix" {
+		return grpc.Dial(addr.String(), creds, grpc.WithContextDialer(func(ctx context.Context, path string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}))
+	}
+
+	return grpc.Dial(addr.String(), creds)
+}
+
+// baseURL returns the URL of the listener. Unix sockets are addressed by their
+// file name, which Client resolves within the socket directory.
+func baseURL(addr net.Addr, secure bool) string {
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+
+	if addr.Network() == "unix" {
+		return scheme + filepath.Base(addr.String())
+	}
+	return scheme + addr.String()
+}
+
+// certPool returns a pool trusting the certificates of the PEM file.
+func certPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// Close closes the gRPC client connection and shuts the server down
+// through the kit graceful shutdown path.
+func (s *Server) Close() error {
+	if s.Conn != nil {
+		s.Conn.Close()
+	}
+
+	err := s.Server.Stop()
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+
+	return err
+}
@@ -0,0 +1,293 @@
+package kittest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testService struct{}
+
+func (testService) Config() kit.Config {
+	cfg := kit.DefaultConfig()
+	// enables the admin listener, which New binds to a free port.
+	cfg.AdminPort = 8082
+	cfg.LoggerLevel = "error"
+	return cfg
+}
+
+func (testService) HTTPHandler() http.Handler {
+	handler := gin.New()
+	handler.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	return handler
+}
+
+func (testService) RPCMiddleware() grpc.UnaryServerInterceptor { return nil }
+func (testService) RPCServiceDesc() *grpc.ServiceDesc          { return nil }
+func (testService) RPCOptions() []grpc.ServerOption            { return nil }
+
+// rpcService serves the standard gRPC health service.
+type rpcService struct {
+	testService
+	*health.Server
+
+	cfg kit.Config
+}
+
+func newRPCService() rpcService {
+	cfg := testService{}.Config()
+	cfg.RPCPort = 0
+	return rpcService{Server: health.NewServer(), cfg: cfg}
+}
+
+func (s rpcService) Config() kit.Config { return s.cfg }
+
+func (rpcService) RPCServiceDesc() *grpc.ServiceDesc {
+	return &healthpb.Health_ServiceDesc
+}
+
+// checkHealth calls the health service over the gRPC connection of the server.
+func checkHealth(t *testing.T, srv *Server) {
+	if !assert.NotNil(t, srv.Conn) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(srv.Conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+}
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key to dir.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kittest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	srv := New(t, testService{})
+
+	res, err := http.Get(srv.URL + "/ping")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "pong", string(body))
+	assert.Nil(t, srv.Conn)
+}
+
+func TestAdmin(t *testing.T) {
+	t.Parallel()
+	srv := New(t, testService{})
+
+	res, err := http.Get(srv.AdminURL + kit.HealthPath)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestServeHTTP(t *testing.T) {
+	t.Parallel()
+	srv := New(t, testService{})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pong", w.Body.String())
+}
+
+func TestWithUnixSockets(t *testing.T) {
+	t.Parallel()
+	srv := New(t, testService{}, WithUnixSockets())
+
+	res, err := srv.Client.Get(srv.URL + "/ping")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = srv.Client.Get(srv.AdminURL + kit.HealthPath)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestConn(t *testing.T) {
+	testCases := map[string]struct {
+		Options    []Option
+		SinglePort bool
+	}{
+		"loopback":     {},
+		"bufconn":      {Options: []Option{WithBufconn()}},
+		"unix sockets": {Options: []Option{WithUnixSockets()}},
+		"single port":  {SinglePort: true},
+	}
+
+	for label, tc := range testCases {
+		tc := tc
+		t.Run(label, func(t *testing.T) {
+			t.Parallel()
+			svc := newRPCService()
+			svc.cfg.SinglePort = tc.SinglePort
+
+			checkHealth(t, New(t, svc, tc.Options...))
+		})
+	}
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+	svc := newRPCService()
+	svc.cfg.TLSCertFile, svc.cfg.TLSKeyFile = writeCert(t, t.TempDir())
+	srv := New(t, svc)
+
+	assert.True(t, strings.HasPrefix(srv.URL, "https://"))
+	res, err := srv.Client.Get(srv.URL + "/ping")
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	checkHealth(t, srv)
+}
+
+// chainService records the order its interceptors run in.
+type chainService struct {
+	rpcService
+
+	mu    *sync.Mutex
+	calls *[]string
+}
+
+func (s chainService) record(name string, ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, deadline := ctx.Deadline()
+	*s.calls = append(*s.calls, fmt.Sprintf("%s %s %t", name, correlation.RequestID(ctx), deadline))
+}
+
+func (s chainService) unary(name string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		s.record(name, ctx)
+		if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("panic")) > 0 {
+			panic("boom")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (s chainService) stream(name string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		s.record(name, stream.Context())
+		return handler(srv, stream)
+	}
+}
+
+func (s chainService) RPCMiddleware() grpc.UnaryServerInterceptor {
+	return s.unary("middleware")
+}
+
+func (s chainService) RPCUnaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{s.unary("first"), s.unary("second")}
+}
+
+func (s chainService) RPCStreamInterceptors() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{s.stream("first"), s.stream("second")}
+}
+
+func TestInterceptorChain(t *testing.T) {
+	t.Parallel()
+	svc := chainService{rpcService: newRPCService(), mu: &sync.Mutex{}, calls: &[]string{}}
+	svc.cfg.RPCStreamTimeout = time.Minute
+	srv := New(t, svc, WithBufconn())
+	client := healthpb.NewHealthClient(srv.Conn)
+
+	calls := func() []string {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+
+		calls := *svc.calls
+		*svc.calls = nil
+		return calls
+	}
+
+	// the default stack runs first: the request ID is set and the stream
+	// deadline enforced before the interceptors of the service.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), extensions.RequestIDMetadataKey, "req-1")
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"middleware req-1 false", "first req-1 false", "second req-1 false"}, calls())
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), extensions.RequestIDMetadataKey, "req-2"))
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if assert.NoError(t, err) {
+		_, err = stream.Recv()
+		assert.NoError(t, err)
+	}
+	cancel()
+	assert.Equal(t, []string{"first req-2 true", "second req-2 true"}, calls())
+
+	// panics of the service interceptors are recovered.
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "panic", "1")
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,369 @@
+package kit
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the redacted values in log entries.
+const Redacted = "[REDACTED]"
+
+var (
+	// DefaultRedactedFields are the fields redacted by DefaultConfig.
+	DefaultRedactedFields = []string{"authorization", "cookie", "set-cookie", "password", "secret", "token"}
+
+	// DefaultRedactedPatterns are the value patterns redacted by DefaultConfig:
+	// credentials of Authorization headers, credential query parameters and
+	// email addresses.
+	DefaultRedactedPatterns = []string{
+		`(?i)\b(?:bearer|basic)\s+[a-z0-9._~+/=-]+`,
+		`(?i)\b(?:access_token|api_key|apikey|password|secret|token)=[^&\s]+`,
+		`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`,
+	}
+)
+
+// redactingFormatter redacts the entries before handing them to the underlying formatter.
+type redactingFormatter struct {
+	f        logrus.Formatter
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func newRedactingFormatter(f logrus.Formatter, fields, patterns []string) (*redactingFormatter, error) {
+	r := &redactingFormatter{
+		f:      f,
+		fields: map[string]bool{},
+	}
+
+	for _, name := range fields {
+		r.fields[strings.ToLower(name)] = true
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid log redaction pattern %q", pattern)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+func (r *redactingFormatter) redact(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// Format implements logrus.Formatter.
+func (r *redactingFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(e.Data))
+	for key, value := range e.Data {
+		if r.fields[strings.ToLower(key)] {
+			data[key] = Redacted
+			continue
+		}
+		data[key] = r.redactValue(value)
+	}
+
+	// the entry is shared with the hooks: format a copy.
+	redacted := *e
+	redacted.Data = data
+	redacted.Message = r.redact(e.Message)
+	return r.f.Format(&redacted)
+}
+
+// maxRedactDepth bounds the recursion into nested values, which may be cyclic.
+const maxRedactDepth = 8
+
+// redactValue redacts the strings of a field value, recursing into pointers,
+// structs, maps, slices and arrays; fields and map keys named like the
+// redacted fields are replaced as a whole. Values are copied rather than
+// modified, and keep their type so the formatter can encode them, eg.
+// durations or extensions.HTTPRequest. Errors become their redacted message,
+// as formatters encode them, and fmt.Stringer values the formatter cannot see
+// through are replaced with their String when it needs redacting.
+func (r *redactingFormatter) redactValue(value interface{}) interface{} {
+	if redacted, ok := r.redactReflect(reflect.ValueOf(&value).Elem(), 0); ok {
+		return redacted.Interface()
+	}
+	return value
+}
+
+// redactReflect returns a redacted copy of v and true, or v and false when
+// there is nothing to redact.
+func (r *redactingFormatter) redactReflect(v reflect.Value, depth int) (reflect.Value, bool) {
+	if depth > maxRedactDepth {
+		return v, false
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s := r.redact(v.String())
+		if s == v.String() {
+			return v, false
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(s)
+		return out, true
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+
+		// only an empty interface can hold the string replacing an error or a
+		// fmt.Stringer.
+		elem := v.Elem()
+		replaceable := v.NumMethod() == 0 && !(elem.Kind() == reflect.Ptr && elem.IsNil())
+		if err, ok := elem.Interface().(error); ok && replaceable {
+			return reflect.ValueOf(r.redact(err.Error())), true
+		}
+
+		if redacted, ok := r.redactReflect(elem, depth+1); ok {
+			out := reflect.New(v.Type()).Elem()
+			out.Set(redacted)
+			return out, true
+		}
+
+		if s, ok := elem.Interface().(fmt.Stringer); ok && replaceable {
+			str := s.String()
+			if redacted := r.redact(str); redacted != str {
+				return reflect.ValueOf(redacted), true
+			}
+		}
+		return v, false
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, ok := r.redactReflect(v.Elem(), depth+1)
+		if !ok {
+			return v, false
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, true
+
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				// formatters do not encode unexported fields.
+				continue
+			}
+
+			var redacted reflect.Value
+			if r.sensitiveField(field) {
+				redacted = redactedValue(v.Field(i).Type())
+			} else {
+				var ok bool
+				if redacted, ok = r.redactReflect(v.Field(i), depth+1); !ok {
+					continue
+				}
+			}
+
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(redacted)
+		}
+		return out, out.IsValid()
+
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+
+		redacted := map[string]reflect.Value{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if r.fields[strings.ToLower(key)] {
+				redacted[key] = redactedValue(v.Type().Elem())
+			} else if value, ok := r.redactReflect(iter.Value(), depth+1); ok {
+				redacted[key] = value
+			}
+		}
+		if len(redacted) == 0 {
+			return v, false
+		}
+
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter = v.MapRange()
+		for iter.Next() {
+			value, ok := redacted[iter.Key().String()]
+			if !ok {
+				value = iter.Value()
+			}
+			out.SetMapIndex(iter.Key(), value)
+		}
+		return out, true
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// bytes are encoded as base64, not as text.
+			return v, false
+		}
+
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, ok := r.redactReflect(v.Index(i), depth+1)
+			if !ok {
+				continue
+			}
+
+			if !out.IsValid() {
+				if v.Kind() == reflect.Slice {
+					out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+					reflect.Copy(out, v)
+				} else {
+					out = reflect.New(v.Type()).Elem()
+					out.Set(v)
+				}
+			}
+			out.Index(i).Set(elem)
+		}
+		return out, out.IsValid()
+	}
+
+	return v, false
+}
+
+func (r *redactingFormatter) sensitiveField(field reflect.StructField) bool {
+	if r.fields[strings.ToLower(field.Name)] {
+		return true
+	}
+
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	return name != "" && r.fields[strings.ToLower(name)]
+}
+
+// redactedValue is the value replacing a redacted field of type t: [REDACTED]
+// when t can hold it, the zero value otherwise.
+func redactedValue(t reflect.Type) reflect.Value {
+	out := reflect.New(t).Elem()
+	switch {
+	case t.Kind() == reflect.String:
+		out.SetString(Redacted)
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		out.Set(reflect.ValueOf(Redacted))
+	}
+	return out
+}
+
+type logSampling struct {
+	level      string
+	first      int
+	thereafter int
+	tick       time.Duration
+}
+
+// samplingHook writes the entries of a logger whose own output is discarded,
+// dropping the repetitive ones in the manner of zap sampling: within every
+// tick, the first entries with a given level and message are written, then
+// only every thereafter-th one. Sampling in a hook keeps the formatter free of
+// side effects, and the writer never sees the dropped entries.
+type samplingHook struct {
+	out   io.Writer
+	f     logrus.Formatter
+	level logrus.Level
+	cfg   logSampling
+
+	// outMu serializes the writes, as logrus does for its own output.
+	outMu sync.Mutex
+
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+}
+
+func newSamplingHook(out io.Writer, f logrus.Formatter, cfg logSampling) (*samplingHook, error) {
+	level := logrus.InfoLevel
+	if cfg.level != "" {
+		var err error
+		if level, err = parseLogLevel(cfg.level); err != nil {
+			return nil, errors.Wrap(err, "invalid log sampling level")
+		}
+	}
+
+	if cfg.tick <= 0 {
+		cfg.tick = time.Second
+	}
+
+	return &samplingHook{
+		out:    out,
+		f:      f,
+		level:  level,
+		cfg:    cfg,
+		counts: map[string]int{},
+	}, nil
+}
+
+func (s *samplingHook) sample(e *logrus.Entry) bool {
+	if e.Level < s.level {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); now.Sub(s.window) >= s.cfg.tick {
+		s.window = now
+		s.counts = map[string]int{}
+	}
+
+	key := e.Level.String() + "|" + e.Message
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.cfg.first {
+		return true
+	}
+
+	return s.cfg.thereafter > 0 && (n-s.cfg.first)%s.cfg.thereafter == 0
+}
+
+// Levels implements logrus.Hook.
+func (s *samplingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (s *samplingHook) Fire(e *logrus.Entry) error {
+	if !s.sample(e) {
+		return nil
+	}
+
+	b, err := s.f.Format(e)
+	if err != nil {
+		return err
+	}
+
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	_, err = s.out.Write(b)
+	return err
+}
+
+// discardFormatter formats nothing, for loggers writing through a hook to
+// io.Discard.
+type discardFormatter struct{}
+
+// Format implements logrus.Formatter.
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
@@ -1,16 +1,24 @@
 package kit
 
 import (
-	"fmt"
+	"encoding/json"
+	"io"
+	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/insighted4/insighted-go/kit/logging"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	logLevels  = []string{"panic", "fatal", "error", "warn", "info", "debug"}
-	logFormats = []string{"json", "text"}
+	logFormats = []string{"json", "text", "gcp"}
 )
 
 type utcFormatter struct {
@@ -24,39 +32,277 @@ func (f *utcFormatter) Format(e *logrus.Entry) ([]byte, error) {
 }
 
 // NewLogger creates a new logger. Configuration should be set by changing level (eg.: panic, fatal, error, warn, info, debug)
-// format (eg.: text, json).
+// format (eg.: text, json, gcp).
+//
+// It panics when the level or the format is not supported; see NewLoggerWithOptions.
 func NewLogger(level string, format string) logrus.FieldLogger {
-	var logLevel logrus.Level
+	logger, err := NewLoggerWithOptions(WithLogLevel(level), WithLogFormat(format))
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return logger
+}
+
+type loggerOptions struct {
+	level          string
+	format         string
+	out            io.Writer
+	redactFields   []string
+	redactPatterns []string
+	sampling       *logSampling
+}
+
+// LoggerOption configures a logger created by NewLoggerWithOptions.
+type LoggerOption func(*loggerOptions)
+
+// WithLogLevel sets the level (eg.: panic, fatal, error, warn, info, debug). The default is info.
+func WithLogLevel(level string) LoggerOption {
+	return func(o *loggerOptions) {
+		o.level = level
+	}
+}
+
+// WithLogFormat sets the format (eg.: text, json, gcp). The default is json.
+func WithLogFormat(format string) LoggerOption {
+	return func(o *loggerOptions) {
+		o.format = format
+	}
+}
+
+// WithLogOutput sets the writer entries are written to. The default is os.Stderr.
+func WithLogOutput(w io.Writer) LoggerOption {
+	return func(o *loggerOptions) {
+		o.out = w
+	}
+}
+
+// WithRedactedFields replaces the value of the given fields, matched case
+// insensitively, with [REDACTED].
+func WithRedactedFields(names ...string) LoggerOption {
+	return func(o *loggerOptions) {
+		o.redactFields = append(o.redactFields, names...)
+	}
+}
+
+// WithRedactedPatterns replaces the parts of messages and field values, including
+// nested ones, matching the given regular expressions with [REDACTED].
+func WithRedactedPatterns(patterns ...string) LoggerOption {
+	return func(o *loggerOptions) {
+		o.redactPatterns = append(o.redactPatterns, patterns...)
+	}
+}
+
+// WithLogSampling samples the entries at the given level and the more verbose
+// ones: within every tick, the first entries with a given message are logged,
+// then only every thereafter-th one. Entries more severe than level are always
+// logged. The sampled entries are written by a hook, registered before any
+// other, so SetOutput and SetFormatter have no effect on the logger: use
+// WithLogOutput and WithLogFormat instead. Hooks added to the logger still
+// see every entry.
+func WithLogSampling(level string, first, thereafter int, tick time.Duration) LoggerOption {
+	return func(o *loggerOptions) {
+		o.sampling = &logSampling{
+			level:      level,
+			first:      first,
+			thereafter: thereafter,
+			tick:       tick,
+		}
+	}
+}
+
+// WithLoggerConfig applies the logger settings of the configuration: level,
+// format, redaction and sampling. Empty level and format keep the defaults.
+func WithLoggerConfig(cfg Config) LoggerOption {
+	return func(o *loggerOptions) {
+		if cfg.LoggerLevel != "" {
+			o.level = cfg.LoggerLevel
+		}
+		if cfg.LoggerFormat != "" {
+			o.format = cfg.LoggerFormat
+		}
+		o.redactFields = append(o.redactFields, cfg.LoggerRedactFields...)
+		o.redactPatterns = append(o.redactPatterns, cfg.LoggerRedactPatterns...)
+		if cfg.LoggerSampleFirst > 0 {
+			WithLogSampling(cfg.LoggerSampleLevel, cfg.LoggerSampleFirst, cfg.LoggerSampleThereafter, time.Second)(o)
+		}
+	}
+}
+
+// NewLoggerWithOptions creates a new logger. Unlike NewLogger, it reports
+// unsupported settings with an error.
+func NewLoggerWithOptions(opts ...LoggerOption) (*logrus.Logger, error) {
+	o := loggerOptions{
+		level:  "info",
+		format: "json",
+		out:    os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	level, err := parseLogLevel(o.level)
+	if err != nil {
+		return nil, err
+	}
+
+	var formatter logrus.Formatter
+	switch strings.ToLower(o.format) {
+	case "text":
+		formatter = &logrus.TextFormatter{DisableColors: true}
+	case "json":
+		formatter = &logrus.JSONFormatter{}
+	case "gcp":
+		formatter = &GCPFormatter{ProjectID: os.Getenv("GOOGLE_CLOUD_PROJECT")}
+	default:
+		return nil, errors.Errorf("log format is not one of the supported values (%s): %s", strings.Join(logFormats, ", "), o.format)
+	}
+	formatter = &utcFormatter{f: formatter}
+
+	if len(o.redactFields) > 0 || len(o.redactPatterns) > 0 {
+		if formatter, err = newRedactingFormatter(formatter, o.redactFields, o.redactPatterns); err != nil {
+			return nil, err
+		}
+	}
+
+	logger := &logrus.Logger{
+		Out:       o.out,
+		Formatter: formatter,
+		Hooks:     make(logrus.LevelHooks),
+		Level:     level,
+	}
+
+	if o.sampling != nil {
+		hook, err := newSamplingHook(o.out, formatter, *o.sampling)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Out = io.Discard
+		logger.Formatter = discardFormatter{}
+		logger.AddHook(hook)
+	}
+
+	return logger, nil
+}
+
+// LoggerHandlerOptions returns the extensions.LoggerHandler options matching
+// the logger settings of the configuration: requests are logged under the
+// httpRequest field for the gcp format only.
+func LoggerHandlerOptions(cfg Config) []extensions.LoggerHandlerOption {
+	if strings.ToLower(cfg.LoggerFormat) == "gcp" {
+		return []extensions.LoggerHandlerOption{extensions.WithHTTPRequestField()}
+	}
+	return nil
+}
+
+// NewSlogLogger creates a *slog.Logger writing through a logger created by
+// NewLoggerWithOptions, with the same format, redaction and sampling.
+func NewSlogLogger(opts ...LoggerOption) (*slog.Logger, error) {
+	logger, err := NewLoggerWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return slog.New(logging.NewHandler(logging.FromLogrus(logger))), nil
+}
+
+func parseLogLevel(level string) (logrus.Level, error) {
 	switch strings.ToLower(level) {
 	case "panic":
-		logLevel = logrus.PanicLevel
+		return logrus.PanicLevel, nil
 	case "fatal":
-		logLevel = logrus.FatalLevel
+		return logrus.FatalLevel, nil
 	case "error":
-		logLevel = logrus.ErrorLevel
+		return logrus.ErrorLevel, nil
 	case "warn":
-		logLevel = logrus.WarnLevel
+		return logrus.WarnLevel, nil
 	case "info":
-		logLevel = logrus.InfoLevel
+		return logrus.InfoLevel, nil
 	case "debug":
-		logLevel = logrus.DebugLevel
+		return logrus.DebugLevel, nil
 	default:
-		panic(fmt.Sprintf("log level is not one of the supported values (%s): %s", strings.Join(logLevels, ", "), level))
+		return 0, errors.Errorf("log level is not one of the supported values (%s): %s", strings.Join(logLevels, ", "), level)
 	}
+}
 
-	var formatter utcFormatter
-	switch strings.ToLower(format) {
-	case "text":
-		formatter.f = &logrus.TextFormatter{DisableColors: true}
-	case "json":
-		formatter.f = &logrus.JSONFormatter{}
-	default:
-		panic(fmt.Sprintf("log format is not one of the supported values (%s), falling back to json: %s", strings.Join(logFormats, ", "), format))
+// GCPFormatter formats log entries as JSON understood by Google Cloud Logging:
+// levels are mapped to severities, trace fields set by the correlation package
+// link entries to their Cloud Trace traces, and the httpRequest field set by
+// extensions.LoggerHandler, see LoggerHandlerOptions, is displayed as a request.
+type GCPFormatter struct {
+	// ProjectID is the Google Cloud project the traces belong to. The
+	// "gcp" format reads it from the GOOGLE_CLOUD_PROJECT environment variable.
+	ProjectID string
+}
+
+var gcpSeverities = map[logrus.Level]string{
+	logrus.TraceLevel: "DEBUG",
+	logrus.DebugLevel: "DEBUG",
+	logrus.InfoLevel:  "INFO",
+	logrus.WarnLevel:  "WARNING",
+	logrus.ErrorLevel: "ERROR",
+	logrus.FatalLevel: "CRITICAL",
+	logrus.PanicLevel: "ALERT",
+}
+
+// gcpReservedFields are the fields set by GCPFormatter itself. Entry fields
+// with the same name are prefixed with "fields.", as logrus.JSONFormatter does.
+var gcpReservedFields = []string{"severity", "message", "time", "logging.googleapis.com/sourceLocation"}
+
+// Format implements logrus.Formatter.
+func (f *GCPFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(e.Data)+4)
+	for key, value := range e.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		data[key] = value
+	}
+
+	for _, key := range gcpReservedFields {
+		if value, ok := data[key]; ok {
+			data["fields."+key] = value
+			delete(data, key)
+		}
 	}
 
-	return &logrus.Logger{
-		Out:       os.Stderr,
-		Formatter: &formatter,
-		Level:     logLevel,
+	if traceID, ok := data[correlation.TraceIDField].(string); ok {
+		delete(data, correlation.TraceIDField)
+		if f.ProjectID != "" {
+			traceID = "projects/" + f.ProjectID + "/traces/" + traceID
+		}
+		data["logging.googleapis.com/trace"] = traceID
 	}
+	if spanID, ok := data[correlation.SpanIDField]; ok {
+		delete(data, correlation.SpanIDField)
+		data["logging.googleapis.com/spanId"] = spanID
+	}
+	if sampled, ok := data[correlation.TraceSampledField]; ok {
+		delete(data, correlation.TraceSampledField)
+		data["logging.googleapis.com/trace_sampled"] = sampled
+	}
+
+	severity, ok := gcpSeverities[e.Level]
+	if !ok {
+		severity = "DEFAULT"
+	}
+	data["severity"] = severity
+	data["message"] = e.Message
+	data["time"] = e.Time.Format(time.RFC3339Nano)
+
+	if e.HasCaller() {
+		data["logging.googleapis.com/sourceLocation"] = map[string]string{
+			"file":     e.Caller.File,
+			"line":     strconv.Itoa(e.Caller.Line),
+			"function": e.Caller.Function,
+		}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal fields to JSON")
+	}
+
+	return append(b, '\n'), nil
 }
@@ -0,0 +1,253 @@
+package kit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/correlation"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCPFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &logrus.Logger{
+		Out:       &buf,
+		Formatter: &GCPFormatter{ProjectID: "insighted"},
+		Level:     logrus.DebugLevel,
+	}
+
+	tp, err := correlation.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	ctx := correlation.WithTraceParent(correlation.WithRequestID(context.Background(), "abc"), tp)
+
+	logger.WithFields(correlation.Fields(ctx)).WithFields(logrus.Fields{
+		"message":     "shadowed",
+		"error":       errors.New("boom"),
+		"httpRequest": &extensions.HTTPRequest{RequestMethod: "GET", RequestURL: "/users", Status: 200, Latency: "0.100000000s"},
+	}).WithTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)).Warn("hello")
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	assert.Equal(t, "WARNING", entry["severity"])
+	assert.Equal(t, "hello", entry["message"])
+	assert.Equal(t, "shadowed", entry["fields.message"])
+	assert.Equal(t, "2020-01-02T03:04:05Z", entry["time"])
+	assert.Equal(t, "boom", entry["error"])
+	assert.Equal(t, "abc", entry["x-request-id"])
+	assert.Equal(t, "projects/insighted/traces/4bf92f3577b34da6a3ce929d0e0e4736", entry["logging.googleapis.com/trace"])
+	assert.Equal(t, "00f067aa0ba902b7", entry["logging.googleapis.com/spanId"])
+	assert.Equal(t, true, entry["logging.googleapis.com/trace_sampled"])
+	assert.NotContains(t, entry, "trace-id")
+	assert.Equal(t, map[string]interface{}{
+		"requestMethod": "GET",
+		"requestUrl":    "/users",
+		"status":        float64(200),
+		"latency":       "0.100000000s",
+	}, entry["httpRequest"])
+}
+
+func TestGCPSeverities(t *testing.T) {
+	testCases := map[string]struct {
+		Level    logrus.Level
+		Severity string
+	}{
+		"debug": {logrus.DebugLevel, "DEBUG"},
+		"info":  {logrus.InfoLevel, "INFO"},
+		"error": {logrus.ErrorLevel, "ERROR"},
+		"fatal": {logrus.FatalLevel, "CRITICAL"},
+		"panic": {logrus.PanicLevel, "ALERT"},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			b, err := (&GCPFormatter{}).Format(&logrus.Entry{Level: tc.Level, Data: logrus.Fields{}})
+			assert.NoError(t, err)
+
+			var entry map[string]interface{}
+			assert.NoError(t, json.Unmarshal(b, &entry))
+			assert.Equal(t, tc.Severity, entry["severity"])
+		})
+	}
+}
+
+func TestNewLoggerWithOptions(t *testing.T) {
+	testCases := map[string]struct {
+		Options []LoggerOption
+		Error   bool
+	}{
+		"defaults":         {nil, false},
+		"text":             {[]LoggerOption{WithLogLevel("debug"), WithLogFormat("text")}, false},
+		"invalid level":    {[]LoggerOption{WithLogLevel("verbose")}, true},
+		"invalid format":   {[]LoggerOption{WithLogFormat("xml")}, true},
+		"invalid pattern":  {[]LoggerOption{WithRedactedPatterns("(")}, true},
+		"invalid sampling": {[]LoggerOption{WithLogSampling("verbose", 1, 0, time.Second)}, true},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			logger, err := NewLoggerWithOptions(tc.Options...)
+			if tc.Error {
+				assert.Error(t, err)
+				assert.Nil(t, logger)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, logger)
+			}
+		})
+	}
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	logger, err := NewLoggerWithOptions(WithLoggerConfig(cfg), WithLogOutput(&buf))
+	assert.NoError(t, err)
+
+	fields := logrus.Fields{
+		"Authorization": "Bearer abc.def.ghi",
+		"password":      "hunter2",
+		"header":        "Basic dXNlcjpwYXNz",
+		"error":         errors.New("unknown user jane@example.com"),
+		"user":          "jane",
+	}
+	logger.WithFields(fields).Info("signed in jane@example.com")
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	assert.Equal(t, "signed in [REDACTED]", entry["msg"])
+	assert.Equal(t, Redacted, entry["Authorization"])
+	assert.Equal(t, Redacted, entry["password"])
+	assert.Equal(t, Redacted, entry["header"])
+	assert.Equal(t, "unknown user [REDACTED]", entry["error"])
+	assert.Equal(t, "jane", entry["user"])
+
+	// the entry itself is left untouched.
+	assert.Equal(t, "hunter2", fields["password"])
+}
+
+func TestLoggerRedactionKeepsStructuredFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	logger, err := NewLoggerWithOptions(WithLoggerConfig(DefaultConfig()), WithLogFormat("gcp"), WithLogOutput(&buf))
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(extensions.LoggerHandler(logger, time.RFC3339, true, extensions.WithHTTPRequestField()))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users?email=jane@example.com", nil))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	httpRequest, ok := entry["httpRequest"].(map[string]interface{})
+	if assert.True(t, ok, "httpRequest is not an object: %v", entry["httpRequest"]) {
+		assert.Equal(t, "GET", httpRequest["requestMethod"])
+		assert.Equal(t, float64(http.StatusOK), httpRequest["status"])
+	}
+	assert.IsType(t, float64(0), entry["latency"])
+	assert.Equal(t, "/users?email=[REDACTED]", entry["uri"])
+}
+
+func TestLoggerHandlerOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := map[string]struct {
+		Format      string
+		HTTPRequest bool
+	}{
+		"json": {Format: "json"},
+		"text": {Format: "text"},
+		"gcp":  {Format: "gcp", HTTPRequest: true},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var buf bytes.Buffer
+			cfg := DefaultConfig()
+			cfg.LoggerFormat = tc.Format
+			logger, err := NewLoggerWithOptions(WithLoggerConfig(cfg), WithLogOutput(&buf))
+			assert.NoError(t, err)
+
+			router := gin.New()
+			router.Use(extensions.LoggerHandler(logger, time.RFC3339, true, LoggerHandlerOptions(cfg)...))
+			router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+			assert.Equal(t, tc.HTTPRequest, strings.Contains(buf.String(), "httpRequest"))
+		})
+	}
+}
+
+type redactedStringer struct{ url string }
+
+func (s redactedStringer) String() string { return s.url }
+
+func TestLoggerRedactionNestedValues(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLoggerWithOptions(WithLoggerConfig(DefaultConfig()), WithLogOutput(&buf))
+	assert.NoError(t, err)
+
+	type credentials struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+	httpRequest := &extensions.HTTPRequest{RequestMethod: http.MethodGet, RequestURL: "/users?access_token=abc&page=2"}
+	fields := logrus.Fields{
+		"httpRequest": httpRequest,
+		"credentials": credentials{User: "jane", Password: "hunter2"},
+		"headers":     map[string][]string{"Cookie": {"session=abc"}, "From": {"jane@example.com"}},
+		"args":        []interface{}{errors.New("unknown user jane@example.com"), 42},
+		"target":      redactedStringer{url: "https://example.com/?token=abc"},
+		"latency":     time.Second,
+	}
+	logger.WithFields(fields).Info("request")
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	assert.Equal(t, map[string]interface{}{"requestMethod": "GET", "requestUrl": "/users?[REDACTED]&page=2", "status": float64(0), "latency": ""}, entry["httpRequest"])
+	assert.Equal(t, map[string]interface{}{"user": "jane", "password": Redacted}, entry["credentials"])
+	assert.Equal(t, map[string]interface{}{"Cookie": nil, "From": []interface{}{Redacted}}, entry["headers"])
+	assert.Equal(t, []interface{}{"unknown user [REDACTED]", float64(42)}, entry["args"])
+	assert.Equal(t, "https://example.com/?[REDACTED]", entry["target"])
+	assert.Equal(t, float64(time.Second), entry["latency"])
+
+	// the values themselves are left untouched.
+	assert.Equal(t, "/users?access_token=abc&page=2", httpRequest.RequestURL)
+	assert.Equal(t, "hunter2", fields["credentials"].(credentials).Password)
+}
+
+func TestLoggerSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLoggerWithOptions(WithLogOutput(&buf), WithLogSampling("info", 2, 3, time.Hour))
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		logger.Info("request")
+		logger.Warn("slow request")
+	}
+	logger.Info("other")
+
+	counts := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		counts[entry["msg"].(string)]++
+	}
+
+	// the first 2 entries, then every 3rd one: the 5th and the 8th.
+	assert.Equal(t, map[string]int{"request": 4, "slow request": 10, "other": 1}, counts)
+}
@@ -0,0 +1,355 @@
+/*
+Package logging is the logging abstraction of kit and eventsourcing.
+
+Logger is the small interface their APIs log with. FromLogrus adapts a logrus
+logger and FromSlog a *slog.Logger to it, so services standardised on either
+can pass their logger anywhere a Logger is expected. Conversely, NewHandler
+adapts a Logger to slog.Handler, so slog users can write through a logger
+created by kit.NewLoggerWithOptions and its redaction and sampling, and Logrus
+adapts it to logrus.FieldLogger for the APIs still requiring one.
+*/
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are the structured fields of a log entry.
+type Fields map[string]interface{}
+
+// Logger is the logging interface of kit and eventsourcing.
+type Logger interface {
+	WithField(key string, value interface{}) Logger
+	WithFields(fields Fields) Logger
+	WithError(err error) Logger
+
+	// WithContext attaches ctx to the entries, eg. for handlers reading the
+	// trace context.
+	WithContext(ctx context.Context) Logger
+
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// LevelFatal is the slog level of the logrus fatal and panic levels.
+const LevelFatal = slog.LevelError + 4
+
+// levelTrace is the slog level of the logrus trace level.
+const levelTrace = slog.LevelDebug - 4
+
+// SlogLevel returns the slog level of a logrus level.
+func SlogLevel(level logrus.Level) slog.Level {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return LevelFatal
+	case logrus.ErrorLevel:
+		return slog.LevelError
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	case logrus.DebugLevel:
+		return slog.LevelDebug
+	default:
+		return levelTrace
+	}
+}
+
+// LogrusLevel returns the logrus level of a slog level.
+func LogrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= LevelFatal:
+		return logrus.FatalLevel
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
+
+// FromLogrus adapts a logrus logger or entry to Logger.
+func FromLogrus(l logrus.FieldLogger) Logger {
+	return logrusLogger{l: l}
+}
+
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+func (l logrusLogger) WithField(key string, value interface{}) Logger {
+	return logrusLogger{l: l.l.WithField(key, value)}
+}
+
+func (l logrusLogger) WithFields(fields Fields) Logger {
+	return logrusLogger{l: l.l.WithFields(logrus.Fields(fields))}
+}
+
+func (l logrusLogger) WithError(err error) Logger {
+	return logrusLogger{l: l.l.WithError(err)}
+}
+
+func (l logrusLogger) WithContext(ctx context.Context) Logger {
+	switch e := l.l.(type) {
+	case *logrus.Logger:
+		return logrusLogger{l: e.WithContext(ctx)}
+	case *logrus.Entry:
+		return logrusLogger{l: e.WithContext(ctx)}
+	default:
+		return l
+	}
+}
+
+func (l logrusLogger) Debug(args ...interface{})                 { l.l.Debug(args...) }
+func (l logrusLogger) Info(args ...interface{})                  { l.l.Info(args...) }
+func (l logrusLogger) Warn(args ...interface{})                  { l.l.Warn(args...) }
+func (l logrusLogger) Error(args ...interface{})                 { l.l.Error(args...) }
+func (l logrusLogger) Debugf(format string, args ...interface{}) { l.l.Debugf(format, args...) }
+func (l logrusLogger) Infof(format string, args ...interface{})  { l.l.Infof(format, args...) }
+func (l logrusLogger) Warnf(format string, args ...interface{})  { l.l.Warnf(format, args...) }
+func (l logrusLogger) Errorf(format string, args ...interface{}) { l.l.Errorf(format, args...) }
+
+func (l logrusLogger) enabled(level logrus.Level) bool {
+	switch e := l.l.(type) {
+	case *logrus.Logger:
+		return e.IsLevelEnabled(level)
+	case *logrus.Entry:
+		return e.Logger.IsLevelEnabled(level)
+	default:
+		return true
+	}
+}
+
+// FromSlog adapts a *slog.Logger to Logger. Fields become attributes.
+func FromSlog(l *slog.Logger) Logger {
+	// slog loggers created by NewHandler are unwrapped.
+	if h, ok := l.Handler().(*handler); ok && h.prefix == "" {
+		return h.logger
+	}
+
+	return slogLogger{l: l, ctx: context.Background()}
+}
+
+type slogLogger struct {
+	l   *slog.Logger
+	ctx context.Context
+}
+
+func (l slogLogger) WithField(key string, value interface{}) Logger {
+	return slogLogger{l: l.l.With(key, value), ctx: l.ctx}
+}
+
+func (l slogLogger) WithFields(fields Fields) Logger {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		args = append(args, key, fields[key])
+	}
+	return slogLogger{l: l.l.With(args...), ctx: l.ctx}
+}
+
+func (l slogLogger) WithError(err error) Logger {
+	return l.WithField(logrus.ErrorKey, err)
+}
+
+func (l slogLogger) WithContext(ctx context.Context) Logger {
+	return slogLogger{l: l.l, ctx: ctx}
+}
+
+func (l slogLogger) log(level slog.Level, msg string) {
+	l.l.Log(l.ctx, level, msg)
+}
+
+func (l slogLogger) Debug(args ...interface{}) { l.log(slog.LevelDebug, fmt.Sprint(args...)) }
+func (l slogLogger) Info(args ...interface{})  { l.log(slog.LevelInfo, fmt.Sprint(args...)) }
+func (l slogLogger) Warn(args ...interface{})  { l.log(slog.LevelWarn, fmt.Sprint(args...)) }
+func (l slogLogger) Error(args ...interface{}) { l.log(slog.LevelError, fmt.Sprint(args...)) }
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+func (l slogLogger) Warnf(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+// Logrus adapts a Logger to logrus.FieldLogger. Loggers created by FromLogrus
+// are unwrapped; entries of other loggers are handed to them.
+func Logrus(l Logger) logrus.FieldLogger {
+	if lg, ok := l.(logrusLogger); ok {
+		return lg.l
+	}
+
+	logger := &logrus.Logger{
+		Out:       io.Discard,
+		Formatter: discardFormatter{},
+		Hooks:     make(logrus.LevelHooks),
+		// the adapted logger decides which levels are enabled.
+		Level: logrus.TraceLevel,
+	}
+	logger.AddHook(&loggerHook{logger: l})
+	return logger
+}
+
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// loggerHook hands logrus entries to a Logger.
+type loggerHook struct {
+	logger Logger
+}
+
+func (h *loggerHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *loggerHook) Fire(e *logrus.Entry) error {
+	logger := h.logger.WithFields(Fields(e.Data))
+	if e.Context != nil {
+		logger = logger.WithContext(e.Context)
+	}
+
+	switch e.Level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		logger.Debug(e.Message)
+	case logrus.InfoLevel:
+		logger.Info(e.Message)
+	case logrus.WarnLevel:
+		logger.Warn(e.Message)
+	default:
+		logger.Error(e.Message)
+	}
+
+	return nil
+}
+
+// NewHandler returns a slog.Handler writing records to the logger. Attributes
+// become fields; the keys of grouped attributes are prefixed with the group
+// names, eg. "request.method".
+func NewHandler(logger Logger) slog.Handler {
+	return &handler{logger: logger}
+}
+
+type handler struct {
+	logger Logger
+	prefix string
+}
+
+// Enabled implements slog.Handler.
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	switch l := h.logger.(type) {
+	case logrusLogger:
+		return l.enabled(LogrusLevel(level))
+	case slogLogger:
+		return l.l.Enabled(ctx, level)
+	default:
+		return true
+	}
+}
+
+// Handle implements slog.Handler.
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	fields := Fields{}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.prefix, a)
+		return true
+	})
+
+	logger := h.logger.WithFields(fields).WithContext(ctx)
+	if l, ok := logger.(logrusLogger); ok {
+		if e, ok := l.l.(*logrus.Entry); ok {
+			logger = logrusLogger{l: e.WithTime(recordTime(r))}
+		}
+	}
+
+	switch LogrusLevel(r.Level) {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		logger.Debug(r.Message)
+	case logrus.InfoLevel:
+		logger.Info(r.Message)
+	case logrus.WarnLevel:
+		logger.Warn(r.Message)
+	default:
+		// fatal records are logged as errors: slog loggers do not exit.
+		logger.Error(r.Message)
+	}
+
+	return nil
+}
+
+func recordTime(r slog.Record) time.Time {
+	if r.Time.IsZero() {
+		return time.Now()
+	}
+	return r.Time
+}
+
+// WithAttrs implements slog.Handler.
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := Fields{}
+	for _, a := range attrs {
+		addAttr(fields, h.prefix, a)
+	}
+
+	return &handler{logger: h.logger.WithFields(fields), prefix: h.prefix}
+}
+
+// WithGroup implements slog.Handler.
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &handler{logger: h.logger, prefix: h.prefix + name + "."}
+}
+
+func addAttr(fields Fields, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		// groups without a key are inlined.
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(fields, prefix, ga)
+		}
+		return
+	}
+
+	fields[prefix+a.Key] = a.Value.Any()
+}
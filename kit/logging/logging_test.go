@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevels(t *testing.T) {
+	testCases := map[string]struct {
+		Logrus logrus.Level
+		Slog   slog.Level
+	}{
+		"trace": {logrus.TraceLevel, slog.LevelDebug - 4},
+		"debug": {logrus.DebugLevel, slog.LevelDebug},
+		"info":  {logrus.InfoLevel, slog.LevelInfo},
+		"warn":  {logrus.WarnLevel, slog.LevelWarn},
+		"error": {logrus.ErrorLevel, slog.LevelError},
+		"fatal": {logrus.FatalLevel, LevelFatal},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			assert.Equal(t, tc.Slog, SlogLevel(tc.Logrus))
+			assert.Equal(t, tc.Logrus, LogrusLevel(tc.Slog))
+		})
+	}
+}
+
+func TestFromSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := FromSlog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Debug("hidden")
+	logger.WithField("user", "jane").WithError(errors.New("boom")).Warn("hello")
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "hello", entry["msg"])
+	assert.Equal(t, "jane", entry["user"])
+	assert.Equal(t, "boom", entry["error"])
+}
+
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logrusLogger := &logrus.Logger{
+		Out:       &buf,
+		Formatter: &logrus.JSONFormatter{},
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.InfoLevel,
+	}
+	adapter := FromLogrus(logrusLogger)
+	logger := slog.New(NewHandler(adapter))
+
+	assert.False(t, logger.Enabled(context.Background(), slog.LevelDebug))
+	logger.Debug("hidden")
+	logger.With("user", "jane").WithGroup("request").Info("hello", "method", "GET", slog.Group("client", "ip", "127.0.0.1"))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "hello", entry["msg"])
+	assert.Equal(t, "jane", entry["user"])
+	assert.Equal(t, "GET", entry["request.method"])
+	assert.Equal(t, "127.0.0.1", entry["request.client.ip"])
+
+	// loggers created by NewHandler are unwrapped.
+	assert.Equal(t, adapter, FromSlog(logger))
+	assert.Equal(t, logrusLogger, Logrus(FromSlog(logger)))
+}
+
+func TestLogrus(t *testing.T) {
+	var buf bytes.Buffer
+	logger := Logrus(FromSlog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))))
+
+	logger.Debug("hidden")
+	logger.WithFields(logrus.Fields{"user": "jane"}).WithError(errors.New("boom")).Error("hello")
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "hello", entry["msg"])
+	assert.Equal(t, "jane", entry["user"])
+	assert.Equal(t, "boom", entry["error"])
+}
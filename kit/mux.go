@@ -0,0 +1,36 @@
+package kit
+
+import (
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// isGRPCRequest reports whether the request should be routed to the gRPC server.
+func isGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// multiplexHandler routes gRPC requests to the gRPC server and everything else
+// to the given HTTP handler, so both can be served from a single port.
+func multiplexHandler(grpcServer *grpc.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// multiplexProtocols enables HTTP/2 without TLS (h2c with prior knowledge, as
+// used by gRPC clients) next to HTTP/1.1 and HTTP/2 over TLS.
+func multiplexProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
+}
@@ -0,0 +1,99 @@
+package kit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthService serves the standard gRPC health service next to the test
+// HTTP handler.
+type healthService struct {
+	testService
+	*health.Server
+}
+
+func newHealthService() healthService {
+	svc := healthService{newTestService(""), health.NewServer()}
+	svc.desc = &healthpb.Health_ServiceDesc
+	return svc
+}
+
+func TestSinglePort(t *testing.T) {
+	svc := newHealthService()
+	svc.cfg.SinglePort = true
+
+	s := New(svc)
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	assert.Nil(t, s.RPCAddr())
+	addr := "127.0.0.1:" + strconv.Itoa(s.HTTPAddr().(*net.TCPAddr).Port)
+
+	t.Run("gRPC", func(t *testing.T) {
+		cc, err := grpc.Dial(addr, grpc.WithInsecure())
+		assert.NoError(t, err)
+		defer cc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		resp, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+		}
+	})
+
+	h2c := new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+
+	testCases := map[string]struct {
+		Transport   *http.Transport
+		Method      string
+		ContentType string
+		Proto       int
+		Status      int
+		Body        string
+	}{
+		"HTTP/1.1":      {&http.Transport{}, http.MethodGet, "", 1, http.StatusOK, "pong"},
+		"h2c":           {&http.Transport{Protocols: h2c}, http.MethodGet, "", 2, http.StatusOK, "pong"},
+		"HTTP/1.1 grpc": {&http.Transport{}, http.MethodPost, "application/grpc", 1, http.StatusNotFound, ""},
+		"h2c not found": {&http.Transport{Protocols: h2c}, http.MethodPost, "application/json", 2, http.StatusNotFound, ""},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			defer tc.Transport.CloseIdleConnections()
+
+			req, _ := http.NewRequest(tc.Method, "http://"+addr+"/ping", strings.NewReader(""))
+			if tc.ContentType != "" {
+				req.Header.Set("Content-Type", tc.ContentType)
+			}
+
+			resp, err := (&http.Client{Transport: tc.Transport}).Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			// only HTTP/2 requests with a gRPC content type reach the gRPC server.
+			assert.Equal(t, tc.Proto, resp.ProtoMajor)
+			assert.Equal(t, tc.Status, resp.StatusCode)
+			assert.Empty(t, resp.Header.Get("Grpc-Status"))
+			if tc.Body != "" {
+				assert.Equal(t, tc.Body, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package kit
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/insighted4/insighted-go/kit/openapi"
+	"google.golang.org/grpc"
+)
+
+const (
+	// OpenAPIPath is the endpoint serving the OpenAPI document of the services.
+	OpenAPIPath = "/openapi.json"
+
+	// DocsPath is the endpoint serving a page rendering the OpenAPI document.
+	DocsPath = "/docs"
+)
+
+// OpenAPIService can be implemented by services to describe the routes of
+// their HTTPHandler in the OpenAPI document. Paths are relative to PathPrefix.
+type OpenAPIService interface {
+	OpenAPIRoutes() []openapi.Route
+}
+
+// HTTPEndpointRoutes describes endpoints, keyed by gin route, with the Docs
+// of their methods. Services serving endpoints can return it from OpenAPIRoutes.
+func HTTPEndpointRoutes(endpoints map[string]*HTTPEndpoint) []openapi.Route {
+	var routes []openapi.Route
+	for p, e := range endpoints {
+		for method := range e.Methods {
+			r := e.Docs[method]
+			r.Method, r.Path = method, p
+			routes = append(routes, r)
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// NewOpenAPIDocument describes the HTTP routes of the services: the routes
+// returned by OpenAPIService, the endpoints of EndpointService and the gRPC
+// methods registered with RegisterGateway, whose schemas are derived from the
+// proto descriptors. The HTTP handlers of the services are built to find the
+// routes registered with RegisterGateway.
+// Every operation documents the problem details returned on errors.
+func NewOpenAPIDocument(svcs ...Service) (*openapi.Document, error) {
+	gateways := collectGateways(func() { httpHandler(svcs) })
+	return newOpenAPIDocument(gateways, svcs)
+}
+
+// newOpenAPIDocument describes the services, with the gateway routes
+// registered while building their handlers.
+func newOpenAPIDocument(gateways map[string]gatewayRoutes, svcs []Service) (*openapi.Document, error) {
+	title, version := "API", "1.0.0"
+	if len(svcs) > 0 {
+		cfg := svcs[0].Config()
+		if cfg.OpenAPITitle != "" {
+			title = cfg.OpenAPITitle
+		}
+		if cfg.OpenAPIVersion != "" {
+			version = cfg.OpenAPIVersion
+		}
+	}
+
+	doc := openapi.New(title, version)
+	for _, svc := range svcs {
+		prefix := svc.Config().PathPrefix
+
+		var routes []openapi.Route
+		if described, ok := svc.(OpenAPIService); ok {
+			routes = described.OpenAPIRoutes()
+		} else if es, ok := svc.(EndpointService); ok {
+			routes = HTTPEndpointRoutes(es.HTTPEndpoints())
+		}
+		for _, r := range routes {
+			r.Path = joinPaths(prefix, r.Path)
+			doc.AddRoute(r)
+		}
+
+		if desc := svc.RPCServiceDesc(); desc != nil {
+			if err := addGatewayOperations(doc, prefix, desc, gateways[desc.ServiceName]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	problem := &openapi.Response{
+		Description: "Problem details",
+		Content:     map[string]*openapi.MediaType{extensions.ProblemContentType: {Schema: doc.Schema(extensions.Problem{})}},
+	}
+	for _, item := range doc.Paths {
+		for _, op := range item {
+			if _, ok := op.Responses["default"]; !ok {
+				op.Responses["default"] = problem
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// openAPIHandler serves the OpenAPI document of the services, built on the
+// first request, and the docs page in front of the HTTP handler.
+func openAPIHandler(svcs []Service, gateways map[string]gatewayRoutes, next http.Handler) http.Handler {
+	var once sync.Once
+	var spec http.Handler
+
+	// relative, so the page works behind a proxy mounting the server under a prefix.
+	docs := openapi.DocsHandler(strings.TrimPrefix(OpenAPIPath, "/"))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.URL.Path {
+		case OpenAPIPath:
+			once.Do(func() {
+				doc, err := newOpenAPIDocument(gateways, svcs)
+				if err != nil {
+					spec = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+					})
+					return
+				}
+				spec = openapi.Handler(doc)
+			})
+			spec.ServeHTTP(w, r)
+		case DocsPath:
+			docs.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func joinPaths(elem ...string) string {
+	p := path.Join(elem...)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// addGatewayOperations describes the routes registered by RegisterGateway for the service.
+func addGatewayOperations(doc *openapi.Document, prefix string, desc *grpc.ServiceDesc, registered gatewayRoutes) error {
+	if len(registered.bindings) == 0 {
+		return nil
+	}
+
+	schemas := &protoSchemas{
+		doc:      doc,
+		messages: map[string]*descriptor.DescriptorProto{},
+		enums:    map[string]*descriptor.EnumDescriptorProto{},
+		files:    map[string]bool{},
+	}
+	methods := map[string]*descriptor.MethodDescriptorProto{}
+	if file, ok := desc.Metadata.(string); ok {
+		fd, err := schemas.index(file)
+		if err != nil {
+			return err
+		}
+
+		for _, sd := range fd.GetService() {
+			if fullName(fd.GetPackage(), sd.GetName()) != desc.ServiceName {
+				continue
+			}
+			for _, md := range sd.GetMethod() {
+				methods[md.GetName()] = md
+			}
+		}
+	}
+
+	seen := map[string]int{}
+	for _, b := range registered.bindings {
+		route, params, err := ginPath(b.Path)
+		if err != nil {
+			return err
+		}
+
+		md := methods[b.RPC]
+		op := &openapi.Operation{
+			OperationID: b.RPC,
+			Summary:     desc.ServiceName + "." + b.RPC,
+			Tags:        []string{desc.ServiceName},
+			Responses: map[string]*openapi.Response{
+				"200": {
+					Description: http.StatusText(http.StatusOK),
+					Content:     map[string]*openapi.MediaType{"application/json": {Schema: schemas.message(md.GetOutputType())}},
+				},
+			},
+		}
+		if n := seen[b.RPC]; n > 0 {
+			op.OperationID += "_" + strconv.Itoa(n)
+		}
+		seen[b.RPC]++
+
+		bound := map[string]bool{}
+		for _, p := range params {
+			s := &openapi.Schema{Type: "string"}
+			if f := schemas.field(md.GetInputType(), p.field); f != nil {
+				s = schemas.fieldSchema(f)
+			}
+			op.Parameters = append(op.Parameters, &openapi.Parameter{Name: p.name, In: "path", Required: true, Schema: s})
+			bound[strings.SplitN(p.field, ".", 2)[0]] = true
+		}
+
+		switch b.Body {
+		case "*":
+			op.RequestBody = &openapi.RequestBody{
+				Content: map[string]*openapi.MediaType{"application/json": {Schema: schemas.message(md.GetInputType())}},
+			}
+		default:
+			if b.Body != "" {
+				bound[b.Body] = true
+				s := &openapi.Schema{}
+				if f := schemas.field(md.GetInputType(), b.Body); f != nil {
+					s = schemas.fieldSchema(f)
+				}
+				op.RequestBody = &openapi.RequestBody{
+					Content: map[string]*openapi.MediaType{"application/json": {Schema: s}},
+				}
+			}
+
+			// the remaining scalar fields are read from the query string.
+			if m := schemas.messages[md.GetInputType()]; m != nil {
+				for _, f := range m.GetField() {
+					if bound[f.GetName()] || f.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+						continue
+					}
+					op.Parameters = append(op.Parameters, &openapi.Parameter{Name: f.GetName(), In: "query", Schema: schemas.fieldSchema(f)})
+				}
+			}
+		}
+
+		p, _ := openapi.Path(joinPaths(prefix, registered.base, route))
+		doc.Add(b.Method, p, op)
+	}
+
+	return nil
+}
+
+// protoSchemas converts proto messages into schemas of their JSON mapping.
+type protoSchemas struct {
+	doc      *openapi.Document
+	messages map[string]*descriptor.DescriptorProto
+	enums    map[string]*descriptor.EnumDescriptorProto
+	files    map[string]bool
+}
+
+// index registers the messages and enums of the file and of its dependencies
+// by fully qualified name (eg. .package.Message).
+func (p *protoSchemas) index(file string) (*descriptor.FileDescriptorProto, error) {
+	p.files[file] = true
+
+	fd, err := fileDescriptor(file)
+	if err != nil || fd == nil {
+		return fd, err
+	}
+
+	scope := "." + fd.GetPackage()
+	if fd.GetPackage() == "" {
+		scope = ""
+	}
+	p.indexMessages(scope, fd.GetMessageType())
+	for _, e := range fd.GetEnumType() {
+		p.enums[scope+"."+e.GetName()] = e
+	}
+
+	for _, dep := range fd.GetDependency() {
+		if p.files[dep] {
+			continue
+		}
+		if _, err := p.index(dep); err != nil {
+			return nil, err
+		}
+	}
+
+	return fd, nil
+}
+
+func (p *protoSchemas) indexMessages(scope string, messages []*descriptor.DescriptorProto) {
+	for _, m := range messages {
+		name := scope + "." + m.GetName()
+		p.messages[name] = m
+		p.indexMessages(name, m.GetNestedType())
+		for _, e := range m.GetEnumType() {
+			p.enums[name+"."+e.GetName()] = e
+		}
+	}
+}
+
+// field returns the field at the dotted path of the message, or nil.
+func (p *protoSchemas) field(message, fieldPath string) *descriptor.FieldDescriptorProto {
+	var f *descriptor.FieldDescriptorProto
+	for _, name := range strings.Split(fieldPath, ".") {
+		m := p.messages[message]
+		if m == nil {
+			return nil
+		}
+
+		f = nil
+		for _, candidate := range m.GetField() {
+			if candidate.GetName() == name {
+				f = candidate
+				break
+			}
+		}
+		if f == nil {
+			return nil
+		}
+		message = f.GetTypeName()
+	}
+
+	return f
+}
+
+var wellKnownSchemas = map[string]openapi.Schema{
+	".google.protobuf.Timestamp":   {Type: "string", Format: "date-time"},
+	".google.protobuf.Duration":    {Type: "string"},
+	".google.protobuf.FieldMask":   {Type: "string"},
+	".google.protobuf.Empty":       {Type: "object"},
+	".google.protobuf.Struct":      {Type: "object"},
+	".google.protobuf.Any":         {Type: "object"},
+	".google.protobuf.Value":       {},
+	".google.protobuf.ListValue":   {Type: "array", Items: &openapi.Schema{}},
+	".google.protobuf.DoubleValue": {Type: "number", Format: "double", Nullable: true},
+	".google.protobuf.FloatValue":  {Type: "number", Format: "float", Nullable: true},
+	".google.protobuf.Int64Value":  {Type: "string", Format: "int64", Nullable: true},
+	".google.protobuf.UInt64Value": {Type: "string", Format: "uint64", Nullable: true},
+	".google.protobuf.Int32Value":  {Type: "integer", Format: "int32", Nullable: true},
+	".google.protobuf.UInt32Value": {Type: "integer", Format: "int64", Nullable: true},
+	".google.protobuf.BoolValue":   {Type: "boolean", Nullable: true},
+	".google.protobuf.StringValue": {Type: "string", Nullable: true},
+	".google.protobuf.BytesValue":  {Type: "string", Format: "byte", Nullable: true},
+}
+
+// message returns the schema of the message, referencing a component schema
+// unless it is a well-known type.
+func (p *protoSchemas) message(name string) *openapi.Schema {
+	if s, ok := wellKnownSchemas[name]; ok {
+		return &s
+	}
+
+	m := p.messages[name]
+	if m == nil {
+		return &openapi.Schema{Type: "object"}
+	}
+
+	component := strings.TrimPrefix(name, ".")
+	if _, ok := p.doc.Components.Schemas[component]; !ok {
+		// registered first: the message may refer to itself.
+		s := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+		p.doc.Components.Schemas[component] = s
+		for _, f := range m.GetField() {
+			s.Properties[jsonName(f)] = p.fieldSchema(f)
+		}
+	}
+
+	return openapi.Ref(component)
+}
+
+func (p *protoSchemas) fieldSchema(f *descriptor.FieldDescriptorProto) *openapi.Schema {
+	if m := p.messages[f.GetTypeName()]; m != nil && m.GetOptions().GetMapEntry() && len(m.GetField()) == 2 {
+		return &openapi.Schema{Type: "object", AdditionalProperties: p.fieldSchema(m.GetField()[1])}
+	}
+
+	s := p.scalar(f)
+	if f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+		return &openapi.Schema{Type: "array", Items: s}
+	}
+	return s
+}
+
+// scalar follows the proto3 JSON mapping: 64-bit integers are strings and
+// enums their value names.
+func (p *protoSchemas) scalar(f *descriptor.FieldDescriptorProto) *openapi.Schema {
+	switch f.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return &openapi.Schema{Type: "number", Format: "double"}
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return &openapi.Schema{Type: "number", Format: "float"}
+	case descriptor.FieldDescriptorProto_TYPE_INT64,
+		descriptor.FieldDescriptorProto_TYPE_SINT64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return &openapi.Schema{Type: "string", Format: "int64"}
+	case descriptor.FieldDescriptorProto_TYPE_UINT64,
+		descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		return &openapi.Schema{Type: "string", Format: "uint64"}
+	case descriptor.FieldDescriptorProto_TYPE_INT32,
+		descriptor.FieldDescriptorProto_TYPE_SINT32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return &openapi.Schema{Type: "integer", Format: "int32"}
+	case descriptor.FieldDescriptorProto_TYPE_UINT32,
+		descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		return &openapi.Schema{Type: "integer", Format: "int64"}
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return &openapi.Schema{Type: "boolean"}
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return &openapi.Schema{Type: "string", Format: "byte"}
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		s := &openapi.Schema{Type: "string"}
+		if e := p.enums[f.GetTypeName()]; e != nil {
+			for _, v := range e.GetValue() {
+				s.Enum = append(s.Enum, v.GetName())
+			}
+		}
+		return s
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		return p.message(f.GetTypeName())
+	default:
+		return &openapi.Schema{Type: "string"}
+	}
+}
+
+// jsonName is the lowerCamelCase name of the field used by the JSON mapping.
+func jsonName(f *descriptor.FieldDescriptorProto) string {
+	if f.GetJsonName() != "" {
+		return f.GetJsonName()
+	}
+
+	var b strings.Builder
+	upper := false
+	for _, r := range f.GetName() {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,380 @@
+/*
+Package openapi builds OpenAPI 3 documents describing HTTP APIs.
+
+Operations are added with AddRoute, from the Go types of their request and
+response bodies: schemas are derived by reflection, following the encoding/json
+conventions, and shared through the components of the document. Handler serves
+a document as JSON and DocsHandler a page rendering it.
+
+The kit server serves a document describing the routes of its services, see
+kit.Config EnableOpenAPI.
+*/
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	types map[string]reflect.Type
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path, by lowercase method.
+type PathItem map[string]*Operation
+
+// Components holds the schemas referenced by the operations.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Operation describes a route.
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter describes a path or query parameter.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the body of a given content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema is a JSON schema, as restricted by OpenAPI.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// New creates an empty document.
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+		types: map[string]reflect.Type{},
+	}
+}
+
+// Ref returns a reference to the named component schema.
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Add adds an operation. The path uses the OpenAPI syntax, eg. /users/{name}.
+func (d *Document) Add(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+
+	item[strings.ToLower(method)] = op
+}
+
+// Route describes a gin route.
+type Route struct {
+	Method string
+
+	// Path is the gin route, eg. /users/:name.
+	Path string
+
+	Summary string
+	Tags    []string
+
+	// Request is a value of the type of the JSON request body, or nil when
+	// the route has no body.
+	Request interface{}
+
+	// Response is a value of the type of the JSON response body, or nil.
+	Response interface{}
+
+	// Status is the status of successful responses. The default is 200.
+	Status int
+}
+
+// AddRoute adds the operation of a gin route.
+func (d *Document) AddRoute(r Route) *Operation {
+	p, params := Path(r.Path)
+
+	op := &Operation{
+		Summary:   r.Summary,
+		Tags:      r.Tags,
+		Responses: map[string]*Response{},
+	}
+	for _, name := range params {
+		op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+
+	if r.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: d.Schema(r.Request)}},
+		}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := &Response{Description: http.StatusText(status)}
+	if r.Response != nil {
+		resp.Content = map[string]*MediaType{"application/json": {Schema: d.Schema(r.Response)}}
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+
+	d.Add(r.Method, p, op)
+	return op
+}
+
+// Path converts a gin route into an OpenAPI path and returns the names of its parameters.
+func Path(route string) (string, []string) {
+	var params []string
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	unsafeName        = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// Schema returns the schema of the JSON encoding of v. Named struct types are
+// added to the components and referenced.
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.TypeSchema(reflect.TypeOf(v))
+}
+
+// TypeSchema is Schema for a reflect.Type.
+func (d *Document) TypeSchema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.TypeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.TypeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return Ref(d.component(t))
+	default:
+		return &Schema{}
+	}
+}
+
+// component adds the schema of a named struct type to the components and returns its name.
+func (d *Document) component(t reflect.Type) string {
+	name := unsafeName.ReplaceAllString(t.Name(), "_")
+	if other, ok := d.types[name]; ok && other != t {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+
+	if _, ok := d.types[name]; !ok {
+		// registered first: the type may refer to itself.
+		d.types[name] = t
+		d.Components.Schemas[name] = &Schema{}
+		*d.Components.Schemas[name] = *d.structSchema(t)
+	}
+
+	return name
+}
+
+// structSchema follows the encoding/json rules: exported fields, json tags and
+// embedded structs. Fields tagged binding:"required", as validated by gin, are
+// required.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || strings.HasPrefix(f.Name, "XXX_") {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded := d.structSchema(ft)
+			for k, v := range embedded.Properties {
+				if _, ok := s.Properties[k]; !ok {
+					s.Properties[k] = v
+				}
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := d.TypeSchema(f.Type)
+		if strings.Contains(opts, "string") && fs.Ref == "" {
+			fs = &Schema{Type: "string", Format: fs.Format}
+		}
+		s.Properties[name] = fs
+
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s
+}
+
+// Handler returns an http.Handler serving the document as JSON.
+func Handler(d *Document) http.Handler {
+	b, err := json.Marshal(d)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// DocsHandler returns an http.Handler serving a page rendering the document
+// served at specURL with Swagger UI.
+func DocsHandler(specURL string) http.Handler {
+	page := strings.Replace(docsPage, "{{spec}}", strconv.Quote(specURL), 1)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+}
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>API documentation</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      SwaggerUIBundle({url: {{spec}}, dom_id: "#swagger-ui"});
+    };
+  </script>
+</body>
+</html>
+`
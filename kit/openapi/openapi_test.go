@@ -0,0 +1,114 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testAddress struct {
+	City string `json:"city"`
+}
+
+type testBase struct {
+	ID string `json:"id"`
+}
+
+type testUser struct {
+	testBase
+	Name      string            `json:"name" binding:"required"`
+	Age       int               `json:"age,omitempty"`
+	Score     float64           `json:"score"`
+	Count     int64             `json:"count,string"`
+	Tags      []string          `json:"tags"`
+	Avatar    []byte            `json:"avatar"`
+	Labels    map[string]string `json:"labels"`
+	Address   *testAddress      `json:"address"`
+	Friends   []*testUser       `json:"friends"`
+	Created   time.Time         `json:"created"`
+	Extra     interface{}       `json:"extra"`
+	NoTag     bool
+	Ignored   string `json:"-"`
+	unexposed string
+}
+
+func TestSchema(t *testing.T) {
+	doc := New("Test", "1.0.0")
+
+	assert.Equal(t, Ref("testUser"), doc.Schema(&testUser{}))
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, doc.Schema([]string{}))
+	assert.Equal(t, &Schema{Type: "object", Properties: map[string]*Schema{"ok": {Type: "boolean"}}}, doc.Schema(struct {
+		OK bool `json:"ok"`
+	}{}))
+
+	user := doc.Components.Schemas["testUser"]
+	assert.Equal(t, "object", user.Type)
+	assert.Equal(t, []string{"name"}, user.Required)
+	assert.Equal(t, &Schema{Type: "string"}, user.Properties["id"])
+	assert.Equal(t, &Schema{Type: "integer", Format: "int64"}, user.Properties["age"])
+	assert.Equal(t, &Schema{Type: "number", Format: "double"}, user.Properties["score"])
+	assert.Equal(t, &Schema{Type: "string", Format: "int64"}, user.Properties["count"])
+	assert.Equal(t, &Schema{Type: "string", Format: "byte"}, user.Properties["avatar"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, user.Properties["labels"])
+	assert.Equal(t, Ref("testAddress"), user.Properties["address"])
+	assert.Equal(t, &Schema{Type: "array", Items: Ref("testUser")}, user.Properties["friends"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, user.Properties["created"])
+	assert.Equal(t, &Schema{}, user.Properties["extra"])
+	assert.Equal(t, &Schema{Type: "boolean"}, user.Properties["NoTag"])
+	assert.NotContains(t, user.Properties, "Ignored")
+	assert.NotContains(t, user.Properties, "unexposed")
+	assert.Contains(t, doc.Components.Schemas, "testAddress")
+}
+
+func TestPath(t *testing.T) {
+	testCases := map[string]struct {
+		Route  string
+		Path   string
+		Params []string
+	}{
+		"static":    {"/users", "/users", nil},
+		"param":     {"/users/:name", "/users/{name}", []string{"name"}},
+		"catch all": {"/files/*path", "/files/{path}", []string{"path"}},
+		"several":   {"/users/:name/repos/:repo", "/users/{name}/repos/{repo}", []string{"name", "repo"}},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			path, params := Path(tc.Route)
+			assert.Equal(t, tc.Path, path)
+			assert.Equal(t, tc.Params, params)
+		})
+	}
+}
+
+func TestAddRoute(t *testing.T) {
+	doc := New("Test", "1.0.0")
+	doc.AddRoute(Route{
+		Method:   http.MethodPost,
+		Path:     "/users/:name/friends",
+		Summary:  "Add a friend",
+		Request:  testAddress{},
+		Response: testUser{},
+		Status:   http.StatusCreated,
+	})
+
+	op := doc.Paths["/users/{name}/friends"]["post"]
+	if assert.NotNil(t, op) {
+		assert.Equal(t, "Add a friend", op.Summary)
+		assert.Equal(t, []*Parameter{{Name: "name", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, op.Parameters)
+		assert.Equal(t, Ref("testAddress"), op.RequestBody.Content["application/json"].Schema)
+		assert.Equal(t, Ref("testUser"), op.Responses["201"].Content["application/json"].Schema)
+	}
+
+	w := httptest.NewRecorder()
+	Handler(doc).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var served map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Equal(t, Version, served["openapi"])
+}
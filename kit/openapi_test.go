@@ -0,0 +1,142 @@
+package kit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/insighted4/insighted-go/kit/openapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+type openAPITestService struct {
+	testService
+}
+
+type pingResponse struct {
+	Message string `json:"message"`
+}
+
+func (s openAPITestService) OpenAPIRoutes() []openapi.Route {
+	return HTTPEndpointRoutes(map[string]*HTTPEndpoint{
+		"/ping": {
+			Methods: map[string]gin.HandlerFunc{http.MethodGet: nil},
+			Docs:    map[string]openapi.Route{http.MethodGet: {Summary: "Ping", Response: pingResponse{}}},
+		},
+	})
+}
+
+func TestNewOpenAPIDocument(t *testing.T) {
+	svc := openAPITestService{newTestService("/a")}
+	svc.cfg.OpenAPITitle = "Test"
+	svc.desc = &grpc.ServiceDesc{ServiceName: "test.Echo"}
+	gateways := map[string]gatewayRoutes{"test.Echo": {base: "/v1", bindings: []GatewayBinding{
+		{RPC: "Echo", Method: http.MethodGet, Path: "/echo/{message}"},
+		{RPC: "Echo", Method: http.MethodPost, Path: "/echo", Body: "*"},
+	}}}
+
+	doc, err := newOpenAPIDocument(gateways, []Service{svc, newTestService("/b")})
+	assert.NoError(t, err)
+	assert.Equal(t, "Test", doc.Info.Title)
+
+	ping := doc.Paths["/a/ping"]["get"]
+	if assert.NotNil(t, ping) {
+		assert.Equal(t, "Ping", ping.Summary)
+		assert.Equal(t, openapi.Ref("pingResponse"), ping.Responses["200"].Content["application/json"].Schema)
+		assert.Equal(t, openapi.Ref("Problem"), ping.Responses["default"].Content["application/problem+json"].Schema)
+	}
+
+	get := doc.Paths["/a/v1/echo/{message}"]["get"]
+	if assert.NotNil(t, get) {
+		assert.Equal(t, "Echo", get.OperationID)
+		assert.Equal(t, "message", get.Parameters[0].Name)
+		assert.Nil(t, get.RequestBody)
+	}
+
+	post := doc.Paths["/a/v1/echo"]["post"]
+	if assert.NotNil(t, post) {
+		assert.Equal(t, "Echo_1", post.OperationID)
+		assert.NotNil(t, post.RequestBody)
+	}
+}
+
+func TestProtoSchemas(t *testing.T) {
+	doc := openapi.New("Test", "1.0.0")
+	field := func(name string, typ descriptor.FieldDescriptorProto_Type, label descriptor.FieldDescriptorProto_Label, typeName string) *descriptor.FieldDescriptorProto {
+		return &descriptor.FieldDescriptorProto{Name: proto.String(name), Type: typ.Enum(), Label: label.Enum(), TypeName: proto.String(typeName)}
+	}
+	optional, repeated := descriptor.FieldDescriptorProto_LABEL_OPTIONAL, descriptor.FieldDescriptorProto_LABEL_REPEATED
+
+	schemas := &protoSchemas{
+		doc: doc,
+		messages: map[string]*descriptor.DescriptorProto{
+			".test.User": {
+				Name: proto.String("User"),
+				Field: []*descriptor.FieldDescriptorProto{
+					field("user_id", descriptor.FieldDescriptorProto_TYPE_INT64, optional, ""),
+					field("age", descriptor.FieldDescriptorProto_TYPE_INT32, optional, ""),
+					field("emails", descriptor.FieldDescriptorProto_TYPE_STRING, repeated, ""),
+					field("state", descriptor.FieldDescriptorProto_TYPE_ENUM, optional, ".test.State"),
+					field("created", descriptor.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Timestamp"),
+					field("labels", descriptor.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".test.User.LabelsEntry"),
+					field("friends", descriptor.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".test.User"),
+				},
+			},
+			".test.User.LabelsEntry": {
+				Name:    proto.String("LabelsEntry"),
+				Options: &descriptor.MessageOptions{MapEntry: proto.Bool(true)},
+				Field: []*descriptor.FieldDescriptorProto{
+					field("key", descriptor.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("value", descriptor.FieldDescriptorProto_TYPE_BOOL, optional, ""),
+				},
+			},
+		},
+		enums: map[string]*descriptor.EnumDescriptorProto{
+			".test.State": {Value: []*descriptor.EnumValueDescriptorProto{{Name: proto.String("ACTIVE")}, {Name: proto.String("BLOCKED")}}},
+		},
+	}
+
+	assert.Equal(t, openapi.Ref("test.User"), schemas.message(".test.User"))
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "date-time"}, schemas.message(".google.protobuf.Timestamp"))
+	assert.Equal(t, &openapi.Schema{Type: "object"}, schemas.message(".test.Unknown"))
+
+	user := doc.Components.Schemas["test.User"]
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "int64"}, user.Properties["userId"])
+	assert.Equal(t, &openapi.Schema{Type: "integer", Format: "int32"}, user.Properties["age"])
+	assert.Equal(t, &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "string"}}, user.Properties["emails"])
+	assert.Equal(t, &openapi.Schema{Type: "string", Enum: []string{"ACTIVE", "BLOCKED"}}, user.Properties["state"])
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "date-time"}, user.Properties["created"])
+	assert.Equal(t, &openapi.Schema{Type: "object", AdditionalProperties: &openapi.Schema{Type: "boolean"}}, user.Properties["labels"])
+	assert.Equal(t, &openapi.Schema{Type: "array", Items: openapi.Ref("test.User")}, user.Properties["friends"])
+
+	assert.Equal(t, "user_id", schemas.field(".test.User", "user_id").GetName())
+	assert.Nil(t, schemas.field(".test.User", "missing"))
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := openAPIHandler([]Service{openAPITestService{newTestService("")}}, nil, next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var doc openapi.Document
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Contains(t, doc.Paths, "/ping")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DocsPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"openapi.json"`)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, OpenAPIPath, nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
@@ -0,0 +1,233 @@
+package kit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Run will create a new server and register the given
+// Service and start up the server(s).
+// This will block until the server shuts down after receiving SIGTERM or SIGINT.
+func Run(svc Service) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := svc.Config()
+	l, err := NewLoggerWithOptions(WithLoggerConfig(cfg))
+	if err != nil {
+		return err
+	}
+	logger := l.WithField("component", "server")
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(ch)
+
+	go func() {
+		select {
+		case sig := <-ch:
+			logger.Info("Received signal ", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return RunContext(ctx, svc)
+}
+
+// RunContext starts the given services and blocks until the context is
+// cancelled or one of the listeners fails, then shuts every server down.
+//
+// Services sharing an HTTPPort (or HTTPSocket) are hosted by a single server, using the
+// listeners, timeouts and logger configuration of the first of them; each must
+// set a distinct PathPrefix. Services with distinct ports get their own server,
+// whose admin and RPC listeners must not collide with the ones of the other
+// servers: set distinct AdminPort and RPCPort values, or disable the admin
+// listener of all but one of them. The returned error aggregates the listener and shutdown errors of all servers.
+//
+// When ListenerHandoff is enabled in the configuration of the first service,
+// SIGUSR2 starts a new instance of the binary which inherits the listeners and
+// takes over while this one drains through the graceful shutdown. Draining
+// starts once the new instance reports its servers started; when it fails
+// instead, this one keeps serving.
+func RunContext(ctx context.Context, svcs ...Service) error {
+	if len(svcs) == 0 {
+		return errors.New("no service to run")
+	}
+
+	groups, err := groupServices(svcs)
+	if err != nil {
+		return err
+	}
+
+	var servers []*Server
+	for _, group := range groups {
+		srv := newServer(group)
+		if err := srv.Start(); err != nil {
+			errs := Errors{err}
+			for _, started := range servers {
+				errs = errs.append(started.Stop())
+			}
+			return errs.err()
+		}
+		servers = append(servers, srv)
+	}
+
+	if err := notifyHandoffReady(); err != nil {
+		servers[0].logger.Warn(err)
+	}
+
+	failed := make(chan struct{}, len(servers))
+	for _, srv := range servers {
+		go func(srv *Server) {
+			<-srv.Done()
+			failed <- struct{}{}
+		}(srv)
+	}
+
+	sig := make(chan os.Signal, 1)
+	if svcs[0].Config().ListenerHandoff && len(handoffSignals) > 0 {
+		signal.Notify(sig, handoffSignals...)
+		defer signal.Stop(sig)
+	}
+
+	logger := servers[0].logger
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-failed:
+			break wait
+		case <-sig:
+			var listeners []net.Listener
+			for _, srv := range servers {
+				listeners = append(listeners, srv.listeners()...)
+			}
+
+			proc, err := handoff(listeners)
+			if err != nil {
+				logger.Errorf("Unable to hand off listeners: %v", err)
+				continue
+			}
+
+			logger.Infof("Handed off listeners to process %d, draining", proc.Pid)
+			break wait
+		}
+	}
+
+	var errs Errors
+	for _, srv := range servers {
+		errs = errs.append(srv.Stop())
+		errs = errs.append(srv.Err())
+	}
+
+	return errs.err()
+}
+
+// groupServices groups the services by HTTP address, preserving their order.
+func groupServices(svcs []Service) ([][]Service, error) {
+	var groups [][]Service
+	index := map[string]int{}
+	for _, svc := range svcs {
+		addr := httpAddress(svc.Config())
+		i, ok := index[addr]
+		if !ok {
+			i = len(groups)
+			index[addr] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], svc)
+	}
+
+	// each group gets its own server, binding its own listeners.
+	used := map[string]string{}
+	claim := func(addr, owner string) error {
+		if addr == "" || addr == ":0" {
+			return nil
+		}
+		if other, ok := used[addr]; ok {
+			return errors.Errorf("the %s and the %s both listen on %s", other, owner, addr)
+		}
+		used[addr] = owner
+		return nil
+	}
+
+	for _, group := range groups {
+		cfg := group[0].Config()
+		addr := httpAddress(cfg)
+		if err := claim(addr, "HTTP listener of "+addr); err != nil {
+			return nil, err
+		}
+		if err := claim(adminAddress(cfg), "admin listener of "+addr); err != nil {
+			return nil, err
+		}
+		if hasRPC(group) && !cfg.SinglePort {
+			if err := claim(rpcAddress(cfg), "RPC listener of "+addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, group := range groups {
+		prefixes := map[string]bool{}
+		rpcNames := map[string]bool{}
+		for _, svc := range group {
+			prefix := strings.TrimSuffix(svc.Config().PathPrefix, "/")
+			if prefixes[prefix] {
+				return nil, errors.Errorf("services on HTTP address %s share the path prefix %q", httpAddress(svc.Config()), prefix)
+			}
+			prefixes[prefix] = true
+
+			if gdesc := svc.RPCServiceDesc(); gdesc != nil {
+				if rpcNames[gdesc.ServiceName] {
+					return nil, errors.Errorf("gRPC service %s is registered more than once", gdesc.ServiceName)
+				}
+				rpcNames[gdesc.ServiceName] = true
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+func httpAddress(cfg Config) string {
+	if cfg.HTTPSocket != "" {
+		return cfg.HTTPSocket
+	}
+	return fmt.Sprintf(":%d", cfg.HTTPPort)
+}
+
+// adminAddress returns the address of the admin listener, or "" when it is disabled.
+func adminAddress(cfg Config) string {
+	if cfg.AdminSocket != "" {
+		return cfg.AdminSocket
+	}
+	if cfg.AdminPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf(":%d", cfg.AdminPort)
+}
+
+func rpcAddress(cfg Config) string {
+	if cfg.RPCSocket != "" {
+		return cfg.RPCSocket
+	}
+	return fmt.Sprintf(":%d", cfg.RPCPort)
+}
+
+func hasRPC(svcs []Service) bool {
+	for _, svc := range svcs {
+		if svc.RPCServiceDesc() != nil {
+			return true
+		}
+	}
+	return false
+}
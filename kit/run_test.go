@@ -0,0 +1,144 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+type testService struct {
+	cfg  Config
+	desc *grpc.ServiceDesc
+}
+
+func newTestService(prefix string) testService {
+	cfg := DefaultConfig()
+	cfg.HTTPPort = 0
+	cfg.PathPrefix = prefix
+	cfg.LoggerLevel = "error"
+	return testService{cfg: cfg}
+}
+
+func (s testService) Config() Config { return s.cfg }
+
+func (s testService) HTTPHandler() http.Handler {
+	handler := gin.New()
+	handler.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong"+s.cfg.PathPrefix)
+	})
+	return handler
+}
+
+func (s testService) RPCMiddleware() grpc.UnaryServerInterceptor { return nil }
+func (s testService) RPCServiceDesc() *grpc.ServiceDesc          { return s.desc }
+func (s testService) RPCOptions() []grpc.ServerOption            { return nil }
+
+func TestRunContext(t *testing.T) {
+	dir := t.TempDir()
+	a, b := newTestService("/a"), newTestService("/b")
+	a.cfg.HTTPSocket = filepath.Join(dir, "a.sock")
+	b.cfg.HTTPSocket = filepath.Join(dir, "b.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- RunContext(ctx, a, b)
+	}()
+
+	// each group is served by its own server.
+	for _, svc := range []testService{a, b} {
+		socket := svc.cfg.HTTPSocket
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+
+		var resp *http.Response
+		var err error
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if resp, err = client.Get("http://kit" + svc.cfg.PathPrefix + "/ping"); err == nil {
+				break
+			}
+		}
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "pong"+svc.cfg.PathPrefix, string(body))
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after the context was cancelled")
+	}
+}
+
+func TestGroupServices(t *testing.T) {
+	groups, err := groupServices([]Service{newTestService("/a"), newTestService("/b")})
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+	assert.Len(t, groups[0], 2)
+
+	_, err = groupServices([]Service{newTestService("/a"), newTestService("/a/")})
+	assert.Error(t, err)
+
+	other := newTestService("/a")
+	other.cfg.HTTPPort = 9090
+	groups, err = groupServices([]Service{newTestService("/a"), other})
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	// servers on distinct HTTP ports cannot share the admin or RPC port.
+	first, second := newTestService("/a"), newTestService("/b")
+	first.cfg.AdminPort, second.cfg.AdminPort = 8082, 8082
+	second.cfg.HTTPPort = 9090
+	_, err = groupServices([]Service{first, second})
+	assert.EqualError(t, err, "the admin listener of :0 and the admin listener of :9090 both listen on :8082")
+
+	second.cfg.AdminPort = 0
+	first.desc, second.desc = &grpc.ServiceDesc{ServiceName: "a"}, &grpc.ServiceDesc{ServiceName: "b"}
+	_, err = groupServices([]Service{first, second})
+	assert.EqualError(t, err, "the RPC listener of :0 and the RPC listener of :9090 both listen on :8081")
+}
+
+func TestHTTPHandlerPrefixes(t *testing.T) {
+	handler, err := httpHandler([]Service{newTestService("/a"), newTestService("/b")})
+	assert.NoError(t, err)
+
+	for _, prefix := range []string{"/a", "/b"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, prefix+"/ping", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "pong"+prefix, w.Body.String())
+	}
+}
+
+func TestRPCServiceName(t *testing.T) {
+	assert.Equal(t, "api.GithubProxy", rpcServiceName("/api.GithubProxy/GetUser"))
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	assert.NoError(t, errs.err())
+
+	errs = errs.append(nil)
+	errs = errs.append(errors.New("a"))
+	errs = errs.append(Errors{errors.New("b"), errors.New("c")})
+	assert.Len(t, errs, 3)
+	assert.EqualError(t, errs.err(), "a; b; c")
+}
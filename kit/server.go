@@ -5,155 +5,550 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/insighted4/insighted-go/kit/extensions"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 // Server encapsulates all logic for registering and running a server.
 type Server struct {
-	config  Config
-	service Service
-	logger  logrus.FieldLogger
+	config   Config
+	services []Service
+	logger   logrus.FieldLogger
 
-	httpServer *http.Server
-	grpcServer *grpc.Server
+	httpServer  *http.Server
+	grpcServer  *grpc.Server
+	adminServer *http.Server
+	tls         *certReloader
+	tracing     *tracing
+
+	httpListener  net.Listener
+	rpcListener   net.Listener
+	adminListener net.Listener
+
+	workers []*worker
+	hooks   []ShutdownHook
+	ready   int32
+
+	// started is set once the listeners are bound: Stop is a no-op before.
+	started int32
 
 	// exit chan for graceful shutdown
-	exit chan chan error
+	exit     chan chan error
+	stopOnce sync.Once
+	stopErr  error
+	done     chan struct{}
+
+	// failure records the listener error that triggered the shutdown
+	failOnce sync.Once
+	failure  error
+
+	// configErr records an invalid configuration, reported by Start
+	configErr error
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithHTTPListener serves HTTP on the given listener instead of binding HTTPPort.
+func WithHTTPListener(lis net.Listener) Option {
+	return func(s *Server) {
+		s.httpListener = lis
+	}
+}
+
+// WithRPCListener serves gRPC on the given listener instead of binding RPCPort.
+func WithRPCListener(lis net.Listener) Option {
+	return func(s *Server) {
+		s.rpcListener = lis
+	}
+}
+
+// WithAdminListener serves the admin endpoints on the given listener instead of binding AdminPort.
+func WithAdminListener(lis net.Listener) Option {
+	return func(s *Server) {
+		s.adminListener = lis
+	}
 }
 
 // New will create a new server for the given Service.
 //
 // Generally, users should only use the 'Run' function to start a server and use this
-// function within tests so they may call ServeHTTP.
-func New(svc Service) *Server {
-	cfg := svc.Config()
-	logger := NewLogger(cfg.LoggerLevel, cfg.LoggerFormat)
+// function within tests so they may call ServeHTTP. See the kittest package for a
+// harness serving on ephemeral ports.
+func New(svc Service, opts ...Option) *Server {
+	return newServer([]Service{svc}, opts...)
+}
+
+// newServer creates a server hosting several services on the listeners
+// configured by the first one. HTTP handlers are mounted on their PathPrefix
+// and gRPC services are registered side by side, each with its own interceptors.
+func newServer(svcs []Service, opts ...Option) *Server {
+	cfg := svcs[0].Config()
+	logger, configErr := NewLoggerWithOptions(WithLoggerConfig(cfg))
+	if configErr != nil {
+		logger = logrus.New()
+	}
 
 	s := &Server{
-		config:  cfg,
-		service: svc,
-		logger:  logger.WithField("component", "server"),
-		exit:    make(chan chan error),
+		config:    cfg,
+		services:  svcs,
+		logger:    logger.WithField("component", "server"),
+		exit:      make(chan chan error),
+		done:      make(chan struct{}),
+		configErr: configErr,
 	}
 
-	s.httpServer = createHTTPServer(cfg, svc, logger)
-	s.grpcServer = createGRPCServer(cfg, svc, logger)
+	s.tls = newCertReloader(cfg, logger)
+	s.tracing = newTracing(cfg)
+	s.grpcServer = createGRPCServer(cfg, svcs, logger, s.tls, s.tracing)
+	httpServer, err := createHTTPServer(cfg, svcs, s.grpcServer, s.tls, s.tracing)
+	if s.configErr == nil {
+		s.configErr = err
+	}
+	s.httpServer = httpServer
+	s.adminServer = createAdminServer(cfg, svcs, logger, s.isReady)
+
+	for _, svc := range svcs {
+		if ws, ok := svc.(WorkerService); ok {
+			for _, w := range ws.Workers() {
+				s.AddWorker(w)
+			}
+		}
+
+		if hs, ok := svc.(ShutdownHookService); ok {
+			s.hooks = append(s.hooks, hs.ShutdownHooks()...)
+		}
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
 
 	return s
 }
 
-func createGRPCServer(cfg Config, svc Service, logger logrus.FieldLogger) *grpc.Server {
-	gdesc := svc.RPCServiceDesc()
-	if gdesc == nil {
+func createGRPCServer(cfg Config, svcs []Service, logger logrus.FieldLogger, reloader *certReloader, tracing *tracing) *grpc.Server {
+	var provider trace.TracerProvider
+	if tracing != nil {
+		provider = tracing.provider
+	}
+
+	var options []grpc.ServerOption
+	unaryChains := map[string]grpc.UnaryServerInterceptor{}
+	streamChains := map[string]grpc.StreamServerInterceptor{}
+	for _, svc := range svcs {
+		gdesc := svc.RPCServiceDesc()
+		if gdesc == nil {
+			continue
+		}
+
+		unary, stream := rpcInterceptors(svc.Config(), svc, logger, provider)
+		unaryChains[gdesc.ServiceName] = grpc_middleware.ChainUnaryServer(unary...)
+		streamChains[gdesc.ServiceName] = grpc_middleware.ChainStreamServer(stream...)
+		options = append(options, svc.RPCOptions()...)
+	}
+
+	if len(unaryChains) == 0 {
 		return nil
 	}
 
-	var inters []grpc.UnaryServerInterceptor
+	// dispatch to the interceptors of the service owning the method.
+	options = append(options,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if chain, ok := unaryChains[rpcServiceName(info.FullMethod)]; ok {
+				return chain(ctx, req, info, handler)
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if chain, ok := streamChains[rpcServiceName(info.FullMethod)]; ok {
+				return chain(srv, stream, info, handler)
+			}
+			return handler(srv, stream)
+		}),
+	)
+
+	// in single port mode TLS is terminated by the HTTP server.
+	if reloader != nil && !cfg.SinglePort {
+		options = append(options, grpc.Creds(credentials.NewTLS(reloader.config("h2"))))
+	}
+
+	server := grpc.NewServer(options...)
+	for _, svc := range svcs {
+		if gdesc := svc.RPCServiceDesc(); gdesc != nil {
+			server.RegisterService(gdesc, svc)
+		}
+	}
+
+	return server
+}
+
+// rpcServiceName extracts the service name out of a full method name (/package.Service/Method).
+func rpcServiceName(fullMethod string) string {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		return name[:idx]
+	}
+	return name
+}
+
+// rpcInterceptors returns the interceptor chains of the service: the default
+// stack followed by RPCMiddleware() and RPCInterceptors, if implemented. Spans
+// are recorded by provider, or by the provider of the call context when nil.
+func rpcInterceptors(cfg Config, svc Service, logger logrus.FieldLogger, provider trace.TracerProvider) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+
+	if !cfg.DisableRPCDefaultInterceptors {
+		logger = logger.WithField("component", "rpc")
+		unary = append(unary, extensions.RequestIDUnaryInterceptor())
+		stream = append(stream, extensions.RequestIDStreamInterceptor())
+
+		if cfg.TraceExporter != "" {
+			var opts []extensions.TracingOption
+			if provider != nil {
+				opts = append(opts, extensions.WithTracerProvider(provider))
+			}
+			unary = append(unary, extensions.TracingUnaryInterceptor(opts...))
+			stream = append(stream, extensions.TracingStreamInterceptor(opts...))
+		}
+
+		unary = append(unary,
+			extensions.LoggerUnaryInterceptor(logger),
+			extensions.ErrorUnaryInterceptor(),
+			extensions.RecoveryUnaryInterceptor(logger),
+		)
+		stream = append(stream,
+			extensions.LoggerStreamInterceptor(logger),
+			extensions.ErrorStreamInterceptor(),
+			extensions.RecoveryStreamInterceptor(logger),
+		)
+
+		if cfg.RPCTimeout > 0 {
+			unary = append(unary, extensions.DeadlineUnaryInterceptor(cfg.RPCTimeout))
+		}
+		if cfg.RPCStreamTimeout > 0 {
+			stream = append(stream, extensions.DeadlineStreamInterceptor(cfg.RPCStreamTimeout))
+		}
+	}
+
 	if mw := svc.RPCMiddleware(); mw != nil {
-		inters = append(inters, mw)
+		unary = append(unary, mw)
 	}
 
-	chain := grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(inters...))
-	interceptors := append(svc.RPCOptions(), chain)
+	if inters, ok := svc.(RPCInterceptors); ok {
+		unary = append(unary, inters.RPCUnaryInterceptors()...)
+		stream = append(stream, inters.RPCStreamInterceptors()...)
+	}
 
-	server := grpc.NewServer(interceptors...)
-	server.RegisterService(gdesc, svc)
+	return unary, stream
+}
 
-	return server
+// httpHandler mounts the HTTP handlers of the services on their PathPrefix.
+func httpHandler(svcs []Service) (http.Handler, error) {
+	if len(svcs) == 1 && svcs[0].Config().PathPrefix == "" {
+		return serviceHandler(svcs[0])
+	}
+
+	mux := http.NewServeMux()
+	for _, svc := range svcs {
+		handler, err := serviceHandler(svc)
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := strings.TrimSuffix(svc.Config().PathPrefix, "/")
+		if prefix == "" {
+			mux.Handle("/", handler)
+			continue
+		}
+
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+	}
+
+	return mux, nil
 }
 
-func createHTTPServer(cfg Config, svc Service, logger logrus.FieldLogger) *http.Server {
-	return &http.Server{
-		Handler:        svc.HTTPHandler(),
+// serviceHandler returns the HTTP handler of the service, built from its
+// endpoints for an EndpointService.
+func serviceHandler(svc Service) (http.Handler, error) {
+	if es, ok := svc.(EndpointService); ok {
+		return EndpointHandler(es)
+	}
+	return svc.HTTPHandler(), nil
+}
+
+func createHTTPServer(cfg Config, svcs []Service, grpcServer *grpc.Server, reloader *certReloader, tracing *tracing) (*http.Server, error) {
+	var handler http.Handler
+	var err error
+	gateways := collectGateways(func() { handler, err = httpHandler(svcs) })
+	if err != nil {
+		handler = http.NotFoundHandler()
+	}
+
+	server := &http.Server{
+		Handler:        handler,
 		Addr:           fmt.Sprintf(":%d", cfg.HTTPPort),
 		MaxHeaderBytes: cfg.MaxHeaderBytes,
 		ReadTimeout:    cfg.ReadTimeout,
 		WriteTimeout:   cfg.WriteTimeout,
 		IdleTimeout:    cfg.IdleTimeout,
 	}
+
+	// requests carry the tracer provider of the server, used by the tracing
+	// middleware of the services.
+	if tracing != nil {
+		server.BaseContext = func(net.Listener) context.Context {
+			return extensions.ContextWithTracerProvider(context.Background(), tracing.provider)
+		}
+	}
+
+	if cfg.EnableOpenAPI {
+		server.Handler = openAPIHandler(svcs, gateways, server.Handler)
+	}
+
+	if cfg.SinglePort && grpcServer != nil {
+		server.Handler = multiplexHandler(grpcServer, server.Handler)
+		server.Protocols = multiplexProtocols()
+	}
+
+	if reloader != nil {
+		server.Handler = clientIdentityHandler(server.Handler)
+		server.TLSConfig = reloader.config("h2", "http/1.1")
+	}
+
+	return server, err
 }
 
-func (s *Server) start() error {
-	go func() {
-		err := s.httpServer.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
-			s.logger.Errorf("HTTP server error - initiating shutting down: %v", err)
-			s.stop()
+// Start opens the listeners and starts serving. It returns once the
+// listeners are bound; use Stop to shut the server down.
+func (s *Server) Start() (err error) {
+	if s.configErr != nil {
+		return s.configErr
+	}
+
+	if s.tracing != nil {
+		if err := s.tracing.start(); err != nil {
+			return err
 		}
-	}()
-	s.logger.Infof("Listening and serving HTTP on %s", s.httpServer.Addr)
 
-	if s.grpcServer != nil {
-		addr := fmt.Sprintf(":%d", s.config.RPCPort)
-		lis, err := net.Listen("tcp", addr)
-		if err != nil {
-			return errors.Wrap(err, "failed to listen to RPC port")
+		defer func() {
+			if err != nil {
+				s.tracing.shutdown(context.Background())
+			}
+		}()
+	}
+
+	if s.tls != nil {
+		if err := s.tls.load(); err != nil {
+			return err
 		}
+	}
+
+	if err := inheritedListeners(); err != nil {
+		return err
+	}
 
+	if err := s.listen(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.started, 1)
+
+	if s.tls != nil {
+		go s.tls.watch()
+	}
+
+	// the admin listener goes first so probes and scraping work while the
+	// main listeners come up.
+	if s.adminServer != nil {
+		go s.serveHTTP("Admin", s.adminServer, s.adminListener)
+		s.logger.Infof("Listening and serving admin HTTP on %s", s.adminListener.Addr())
+	}
+
+	go s.serveHTTP("HTTP", s.httpServer, s.httpListener)
+	s.logger.Infof("Listening and serving HTTP on %s", s.httpListener.Addr())
+
+	if s.grpcServer != nil && s.config.SinglePort {
+		s.logger.Infof("Serving RPC on HTTP address: %s", s.httpListener.Addr())
+	} else if s.grpcServer != nil {
 		go func() {
-			err := s.grpcServer.Serve(lis)
+			err := s.grpcServer.Serve(s.rpcListener)
 			if err != nil && strings.Contains(err.Error(), "use of closed network connection") {
 				err = nil
 			}
 
 			if err != nil {
 				s.logger.Errorf("gRPC server error - initiating shutting down: %v", err)
-				s.stop()
+				s.fail(errors.Wrap(err, "gRPC server error"))
 			}
 		}()
-		s.logger.Infof("Listening on RPC port: %d", s.config.RPCPort)
+		s.logger.Infof("Listening on RPC address: %s", s.rpcListener.Addr())
 	}
 
+	s.startWorkers()
+	s.setReady(true)
+
 	go func() {
 		exit := <-s.exit
+		exit <- s.shutdown()
+		close(s.done)
+	}()
 
-		// stop listener with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
-		defer cancel()
+	return nil
+}
 
-		// stop service
-		if shutdown, ok := s.service.(Shutdowner); ok {
-			shutdown.Shutdown()
+// listen binds the listeners that were not provided through options,
+// preferring the ones inherited from a parent process.
+func (s *Server) listen() error {
+	var opened []net.Listener
+	bind := func(lis *net.Listener, port int, socket string, name string) error {
+		if *lis != nil {
+			return nil
 		}
 
-		// stop gRPC server
-		if s.grpcServer != nil {
-			s.grpcServer.GracefulStop()
+		if l := takeInherited(port, socket); l != nil {
+			s.logger.Infof("Inherited %s listener on %s", name, l.Addr())
+			*lis = l
+			return nil
 		}
 
-		// stop HTTP server
-		exit <- s.httpServer.Shutdown(ctx)
-	}()
+		var l net.Listener
+		var err error
+		if socket != "" {
+			l, err = listenUnix(socket, s.config.SocketMode)
+		} else {
+			l, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+		}
+		if err != nil {
+			for _, o := range opened {
+				o.Close()
+			}
+			return errors.Wrapf(err, "failed to listen to %s address", name)
+		}
+
+		opened = append(opened, l)
+		*lis = l
+		return nil
+	}
+
+	if s.adminServer != nil {
+		if err := bind(&s.adminListener, s.config.AdminPort, s.config.AdminSocket, "admin"); err != nil {
+			return err
+		}
+	}
+
+	if err := bind(&s.httpListener, s.config.HTTPPort, s.config.HTTPSocket, "HTTP"); err != nil {
+		return err
+	}
+
+	if s.grpcServer != nil && !s.config.SinglePort {
+		if err := bind(&s.rpcListener, s.config.RPCPort, s.config.RPCSocket, "RPC"); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (s *Server) stop() error {
-	ch := make(chan error)
-	s.exit <- ch
-	return <-ch
+func (s *Server) serveHTTP(name string, server *http.Server, lis net.Listener) {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ServeTLS(lis, "", "")
+	} else {
+		err = server.Serve(lis)
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		s.logger.Errorf("%s server error - initiating shutting down: %v", name, err)
+		s.fail(errors.Wrapf(err, "%s server error", name))
+	}
 }
 
-// Run will create a new server and register the given
-// Service and start up the server(s).
-// This will block until the server shuts down.
-func Run(svc Service) error {
-	srv := New(svc)
+func (s *Server) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
 
-	if err := srv.start(); err != nil {
-		return err
+// isReady reports whether the server accepts traffic: it is started and not shutting down.
+func (s *Server) isReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// fail records the listener error and shuts the server down.
+func (s *Server) fail(err error) {
+	s.failOnce.Do(func() {
+		s.failure = err
+	})
+	s.Stop()
+}
+
+// Stop gracefully shuts the server down and blocks until it is done.
+// It is safe to call Stop more than once, and before Start or after it failed,
+// in which case there is nothing to stop.
+func (s *Server) Stop() error {
+	if atomic.LoadInt32(&s.started) == 0 {
+		return nil
 	}
 
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
-	srv.logger.Info("Received signal ", <-ch)
-	return srv.stop()
+	s.stopOnce.Do(func() {
+		ch := make(chan error)
+		s.exit <- ch
+		s.stopErr = <-ch
+	})
+
+	return s.stopErr
+}
+
+// Done returns a channel closed once the server has shut down, either
+// because Stop was called or because one of its listeners failed.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the listener error that caused the server to shut down, if any.
+// It should only be called after Done is closed.
+func (s *Server) Err() error {
+	return s.failure
+}
+
+// ServeHTTP dispatches the request to the HTTP handler of the service,
+// without going through any listener.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.httpServer.Handler.ServeHTTP(w, r)
+}
+
+// HTTPAddr returns the address of the HTTP listener, or nil before Start.
+func (s *Server) HTTPAddr() net.Addr {
+	return listenerAddr(s.httpListener)
+}
+
+// RPCAddr returns the address of the RPC listener, or nil before Start or
+// when the service has no gRPC representation or runs in single port mode.
+func (s *Server) RPCAddr() net.Addr {
+	return listenerAddr(s.rpcListener)
+}
+
+// AdminAddr returns the address of the admin listener, or nil before Start
+// or when the admin listener is disabled.
+func (s *Server) AdminAddr() net.Addr {
+	return listenerAddr(s.adminListener)
+}
+
+func listenerAddr(lis net.Listener) net.Addr {
+	if lis == nil {
+		return nil
+	}
+	return lis.Addr()
 }
@@ -4,14 +4,23 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/openapi"
 	"google.golang.org/grpc"
 )
 
 // HTTPEndpoint encapsulates everything required to build
 // an endpoint.
 type HTTPEndpoint struct {
+	// Middleware, when set, runs before the handlers of all Methods.
 	Middleware gin.HandlerFunc
-	Methods    map[string]gin.HandlerFunc
+
+	// Methods are the handlers, by HTTP method. Other methods are answered
+	// with 405 Method Not Allowed.
+	Methods map[string]gin.HandlerFunc
+
+	// Docs describes the methods in the OpenAPI document, keyed like
+	// Methods. Method and Path are filled in, see HTTPEndpointRoutes.
+	Docs map[string]openapi.Route
 }
 
 // Service is the interface of mixed HTTP/gRPC that can be registered and
@@ -39,14 +48,37 @@ type Service interface {
 
 	// RPCOptions are for service-wide gRPC server options.
 	//
-	// The underlying kit server already uses the one available grpc.UnaryInterceptor
-	// grpc.ServerOption so attempting to pass your own in this method will cause a panic
-	// at startup. We recommend using RPCMiddleware() to fill this need.
+	// The underlying kit server already uses the grpc.UnaryInterceptor and
+	// grpc.StreamInterceptor grpc.ServerOptions so attempting to pass your own
+	// in this method will cause a panic at startup. We recommend using
+	// RPCMiddleware() or RPCInterceptors to fill this need.
 	RPCOptions() []grpc.ServerOption
 }
 
+// EndpointService is a Service variant declaring its HTTP routes instead of
+// building its own handler. The server serves them with EndpointHandler, which
+// sets up the standard middleware stack; HTTPHandler is not used and may
+// return nil.
+type EndpointService interface {
+	Service
+
+	// HTTPEndpoints returns the endpoints keyed by gin route (eg. /users/:name),
+	// relative to PathPrefix.
+	HTTPEndpoints() map[string]*HTTPEndpoint
+}
+
+// RPCInterceptors can be implemented by services to add lists of unary and
+// stream gRPC interceptors. They are chained, in order, after the default
+// interceptor stack and RPCMiddleware().
+type RPCInterceptors interface {
+	RPCUnaryInterceptors() []grpc.UnaryServerInterceptor
+	RPCStreamInterceptors() []grpc.StreamServerInterceptor
+}
+
 // Shutdowner allows your service to shutdown gracefully when http server stops.
 // This may used when service has any background task which needs to be completed gracefully.
+// Background tasks are better served by the Worker interface, which gets a context
+// and can report errors.
 type Shutdowner interface {
 	Shutdown()
 }
@@ -0,0 +1,181 @@
+package kit
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ShutdownPhase orders the shutdown hooks of a server.
+type ShutdownPhase int
+
+const (
+	// PhasePreDrain runs once readiness is turned off, before waiting
+	// ShutdownDelay for load balancers to stop sending traffic.
+	PhasePreDrain ShutdownPhase = iota
+
+	// PhaseDrain runs once the HTTP and gRPC listeners have drained.
+	PhaseDrain
+
+	// PhaseStopWorkers runs once the workers have been stopped.
+	PhaseStopWorkers
+
+	// PhaseClose runs last and is meant to close resources such as stores
+	// and database pools.
+	PhaseClose
+)
+
+var shutdownPhases = []ShutdownPhase{PhasePreDrain, PhaseDrain, PhaseStopWorkers, PhaseClose}
+
+// String implements fmt.Stringer.
+func (p ShutdownPhase) String() string {
+	switch p {
+	case PhasePreDrain:
+		return "pre-drain"
+	case PhaseDrain:
+		return "drain"
+	case PhaseStopWorkers:
+		return "stop-workers"
+	case PhaseClose:
+		return "close"
+	default:
+		return "unknown"
+	}
+}
+
+// ShutdownHook is a function run during a given phase of the server shutdown.
+// The context is bounded by ShutdownTimeout.
+type ShutdownHook struct {
+	Phase ShutdownPhase
+	Name  string
+	Func  func(ctx context.Context) error
+}
+
+// ShutdownHookService can be implemented by services to register their shutdown hooks.
+type ShutdownHookService interface {
+	ShutdownHooks() []ShutdownHook
+}
+
+// OnShutdown registers a hook run during the given shutdown phase. Hooks of
+// the same phase run in registration order. It must be called before Start.
+func (s *Server) OnShutdown(phase ShutdownPhase, name string, fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, ShutdownHook{
+		Phase: phase,
+		Name:  name,
+		Func:  fn,
+	})
+}
+
+// runHooks runs the hooks of the given phase, logging and collecting their errors.
+func (s *Server) runHooks(ctx context.Context, phase ShutdownPhase) error {
+	var errs Errors
+	for _, hook := range s.hooks {
+		if hook.Phase != phase {
+			continue
+		}
+
+		if err := hook.Func(ctx); err != nil {
+			s.logger.WithField("phase", phase.String()).Errorf("Shutdown hook %s failed: %v", hook.Name, err)
+			errs = append(errs, errors.Wrapf(err, "shutdown hook %s", hook.Name))
+		}
+	}
+
+	return errs.err()
+}
+
+// shutdown runs the shutdown phases in order and returns all the errors reported.
+func (s *Server) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	var errs Errors
+	for _, phase := range shutdownPhases {
+		s.logger.Infof("Shutdown phase: %s", phase)
+
+		switch phase {
+		case PhasePreDrain:
+			s.setReady(false)
+			errs = errs.append(s.runHooks(ctx, phase))
+
+			if delay := s.config.ShutdownDelay; delay > 0 {
+				s.logger.Infof("Waiting %s for load balancers to stop sending traffic", delay)
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+			}
+
+		case PhaseDrain:
+			errs = errs.append(s.drain(ctx))
+			errs = errs.append(s.runHooks(ctx, phase))
+
+		case PhaseStopWorkers:
+			errs = errs.append(s.stopWorkers(ctx))
+			errs = errs.append(s.runHooks(ctx, phase))
+
+		case PhaseClose:
+			errs = errs.append(s.runHooks(ctx, phase))
+		}
+	}
+
+	// stop admin server last so probes and scraping keep working
+	// while the main listeners drain.
+	if s.adminServer != nil {
+		errs = errs.append(s.adminServer.Shutdown(ctx))
+	}
+
+	if s.tracing != nil {
+		errs = errs.append(s.tracing.shutdown(ctx))
+	}
+
+	if s.tls != nil {
+		s.tls.stop()
+	}
+
+	return errs.err()
+}
+
+// drain stops the listeners, waiting for in-flight requests to complete.
+func (s *Server) drain(ctx context.Context) error {
+	// stop services
+	for _, svc := range s.services {
+		if shutdown, ok := svc.(Shutdowner); ok {
+			shutdown.Shutdown()
+		}
+	}
+
+	// stop gRPC server, alongside the HTTP server so both share the deadline.
+	var grpcStopped chan struct{}
+	if s.grpcServer != nil && !s.config.SinglePort {
+		grpcStopped = make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+	}
+
+	// stop HTTP server
+	var errs Errors
+	errs = errs.append(s.httpServer.Shutdown(ctx))
+
+	if grpcStopped != nil {
+		select {
+		case <-grpcStopped:
+		case <-ctx.Done():
+			// long-lived streams would otherwise hold the shutdown forever.
+			s.logger.Warn("gRPC server did not drain in time, closing the remaining connections")
+			s.grpcServer.Stop()
+			<-grpcStopped
+			errs = errs.append(errors.Wrap(ctx.Err(), "gRPC server did not drain"))
+		}
+	}
+
+	// in single port mode gRPC streams are drained by the HTTP server;
+	// GracefulStop is not supported for connections served through ServeHTTP.
+	if s.grpcServer != nil && s.config.SinglePort {
+		s.grpcServer.Stop()
+	}
+
+	return errs.err()
+}
@@ -0,0 +1,123 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+)
+
+func TestShutdownHooks(t *testing.T) {
+	s := New(newTestService(""))
+
+	var calls []string
+	hook := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	s.OnShutdown(PhaseClose, "close", hook("close", errors.New("close failed")))
+	s.OnShutdown(PhasePreDrain, "pre-drain", hook("pre-drain", nil))
+	s.OnShutdown(PhaseStopWorkers, "stop-workers", hook("stop-workers", nil))
+	s.OnShutdown(PhaseDrain, "drain", hook("drain", errors.New("drain failed")))
+	s.OnShutdown(PhasePreDrain, "not ready", func(ctx context.Context) error {
+		assert.False(t, s.isReady())
+		return nil
+	})
+
+	assert.NoError(t, s.Start())
+	assert.True(t, s.isReady())
+
+	err := s.Stop()
+	assert.EqualError(t, err, "shutdown hook drain: drain failed; shutdown hook close: close failed")
+	assert.Equal(t, []string{"pre-drain", "drain", "stop-workers", "close"}, calls)
+}
+
+func TestShutdownBlockedStream(t *testing.T) {
+	started := make(chan struct{})
+	svc := newTestService("")
+	svc.cfg.RPCPort = 0
+	svc.cfg.ShutdownTimeout = 100 * time.Millisecond
+	svc.desc = &grpc.ServiceDesc{
+		ServiceName: "test.Blocking",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Wait",
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				close(started)
+				<-stream.Context().Done()
+				return stream.Context().Err()
+			},
+		}},
+	}
+
+	s := New(svc)
+	assert.NoError(t, s.Start())
+
+	cc, err := grpc.Dial(s.RPCAddr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = cc.NewStream(ctx, &svc.desc.Streams[0], "/test.Blocking/Wait")
+	assert.NoError(t, err)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream did not start")
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop() }()
+
+	select {
+	case err := <-stopped:
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "gRPC server did not drain")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return once ShutdownTimeout elapsed")
+	}
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	svc := newTestService("")
+	svc.cfg.TraceExporter = TraceExporterMemory
+	svc.cfg.HTTPSocket = filepath.Join(t.TempDir(), "missing", "kit.sock")
+	s := New(svc)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop() }()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked before Start")
+	}
+
+	// the listener fails: tracing, started first, is shut down.
+	assert.Error(t, s.Start())
+	_, span := otel.Tracer("test").Start(context.Background(), "after start")
+	span.End()
+	assert.Empty(t, s.Spans())
+
+	go func() { stopped <- s.Stop() }()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked after Start failed")
+	}
+}
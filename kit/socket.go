@@ -0,0 +1,40 @@
+package kit
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// listenUnix listens on the unix domain socket at path with the given file
+// permissions. A stale socket file left behind by a previous process is removed,
+// while a socket still accepting connections is reported as in use.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	return listenSocket(path, mode)
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.Errorf("socket %s is in use", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package kit
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes the umask changes of listenSocket.
+var umaskMu sync.Mutex
+
+// listenSocket creates the socket at path with the given permissions. The
+// umask is restricted while binding, so the socket is never more accessible
+// than mode, as it would be between a bind and a chmod. The umask is process
+// wide: files created meanwhile by other goroutines are as restricted.
+func listenSocket(path string, mode os.FileMode) (net.Listener, error) {
+	if mode == 0 {
+		return net.Listen("unix", path)
+	}
+
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	umask := syscall.Umask(int(^mode.Perm() & os.ModePerm))
+	defer syscall.Umask(umask)
+
+	return net.Listen("unix", path)
+}
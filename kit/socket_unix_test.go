@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package kit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenUnixUmask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	umask := syscall.Umask(022)
+	defer syscall.Umask(umask)
+
+	// the socket is created with its mode, group write included, and the
+	// umask is restored.
+	path := filepath.Join(dir, "kit.sock")
+	lis, err := listenUnix(path, 0660)
+	assert.NoError(t, err)
+	defer lis.Close()
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	assert.Equal(t, 022, syscall.Umask(022))
+}
@@ -0,0 +1,26 @@
+package kit
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// listenSocket creates the socket at path with the given permissions. Windows
+// has no umask: they are set once the socket is created.
+func listenSocket(path string, mode os.FileMode) (net.Listener, error) {
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			lis.Close()
+			return nil, errors.Wrapf(err, "unable to set permissions of socket %s", path)
+		}
+	}
+
+	return lis, nil
+}
@@ -0,0 +1,221 @@
+package kit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type clientIdentityKey struct{}
+
+// TLSEnabled reports whether the configuration asks for the listeners to serve TLS.
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// ClientIdentity returns the verified client certificate of a mutual TLS
+// connection. It works for both gin handlers (using the request context)
+// and gRPC handlers and interceptors.
+func ClientIdentity(ctx context.Context) (*x509.Certificate, bool) {
+	if cert, ok := ctx.Value(clientIdentityKey{}).(*x509.Certificate); ok {
+		return cert, true
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return verifiedLeaf(info.State)
+		}
+	}
+
+	return nil, false
+}
+
+func verifiedLeaf(state tls.ConnectionState) (*x509.Certificate, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return state.VerifiedChains[0][0], true
+}
+
+// clientIdentityHandler exposes the verified client certificate of the
+// request through the request context.
+func clientIdentityHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			if cert, ok := verifiedLeaf(*r.TLS); ok {
+				r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, cert))
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// certReloader keeps the certificate and client CAs in sync with the files
+// on disk, so rotated secrets are picked up without restarting the server.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+	logger   logrus.FieldLogger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+
+	done chan struct{}
+}
+
+func newCertReloader(cfg Config, logger logrus.FieldLogger) *certReloader {
+	if !cfg.TLSEnabled() {
+		return nil
+	}
+
+	return &certReloader{
+		certFile: cfg.TLSCertFile,
+		keyFile:  cfg.TLSKeyFile,
+		caFile:   cfg.TLSClientCAFile,
+		interval: cfg.TLSReloadInterval,
+		logger:   logger.WithField("component", "tls"),
+		modTimes: map[string]time.Time{},
+		done:     make(chan struct{}),
+	}
+}
+
+// load reads the certificate, key and client CAs from disk.
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load TLS key pair")
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read TLS client CA file")
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificates found in TLS client CA file %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.mu.Unlock()
+
+	return nil
+}
+
+// changed reports whether any of the files has been modified since the last check.
+func (r *certReloader) changed() bool {
+	changed := false
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		if last, ok := r.modTimes[file]; !ok || !info.ModTime().Equal(last) {
+			r.modTimes[file] = info.ModTime()
+			changed = changed || ok
+		}
+	}
+
+	return changed
+}
+
+// watch polls the files until stop is called. Polling works across the
+// symlink swaps Kubernetes uses when rotating mounted secrets.
+func (r *certReloader) watch() {
+	interval := r.interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	r.changed()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				r.logger.Errorf("Unable to reload TLS certificates, keeping the current ones: %v", err)
+				continue
+			}
+			r.logger.Info("Reloaded TLS certificates")
+		}
+	}
+}
+
+func (r *certReloader) stop() {
+	close(r.done)
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) getClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// config returns a tls.Config backed by the reloader advertising the given
+// application protocols.
+func (r *certReloader) config(nextProtos ...string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     nextProtos,
+		GetCertificate: r.getCertificate,
+	}
+
+	if r.caFile == "" {
+		return cfg
+	}
+
+	// client CAs are resolved per handshake so a reloaded bundle applies
+	// to new connections straight away.
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     nextProtos,
+			GetCertificate: r.getCertificate,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      r.getClientCAs(),
+		}, nil
+	}
+
+	return cfg
+}
@@ -0,0 +1,253 @@
+package kit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// testCert is a generated certificate and its key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert generates a certificate for 127.0.0.1 signed by parent, or a
+// self-signed CA when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+// write writes the PEM encoded certificate and key to the given files.
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// identityService answers the common name of the client certificate, over
+// HTTP and through the response headers of the test.Identity/Get stream.
+type identityService struct {
+	testService
+}
+
+func (s identityService) HTTPHandler() http.Handler {
+	handler := gin.New()
+	handler.GET("/identity", func(c *gin.Context) {
+		cert, ok := ClientIdentity(c.Request.Context())
+		if !ok {
+			c.String(http.StatusUnauthorized, "")
+			return
+		}
+		c.String(http.StatusOK, cert.Subject.CommonName)
+	})
+	return handler
+}
+
+func (s identityService) RPCServiceDesc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Identity",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Get",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				name := ""
+				if cert, ok := ClientIdentity(stream.Context()); ok {
+					name = cert.Subject.CommonName
+				}
+				return stream.SendHeader(metadata.Pairs("identity", name))
+			},
+		}},
+	}
+}
+
+// newTLSTestService serves a certificate signed by ca, and verifies client
+// certificates against it when mutual is set.
+func newTLSTestService(t *testing.T, ca *testCert, mutual bool) identityService {
+	dir := t.TempDir()
+	svc := identityService{newTestService("")}
+	svc.cfg.RPCPort = 0
+	svc.cfg.TLSCertFile = filepath.Join(dir, "server.crt")
+	svc.cfg.TLSKeyFile = filepath.Join(dir, "server.key")
+	svc.cfg.TLSReloadInterval = 10 * time.Millisecond
+	newTestCert(t, "server", ca).write(t, svc.cfg.TLSCertFile, svc.cfg.TLSKeyFile)
+
+	if mutual {
+		svc.cfg.TLSClientCAFile = filepath.Join(dir, "ca.crt")
+		ca.write(t, svc.cfg.TLSClientCAFile, "")
+	}
+
+	return svc
+}
+
+// localAddr returns the loopback address of a listener bound to all interfaces,
+// matching the IP of the generated certificates.
+func localAddr(addr net.Addr) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.(*net.TCPAddr).Port))
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	svc := newTLSTestService(t, ca, true)
+
+	s := New(svc)
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	client := newTestCert(t, "client", ca)
+	other := newTestCert(t, "client", newTestCert(t, "other ca", nil))
+
+	testCases := map[string]struct {
+		Certs  []tls.Certificate
+		Status int
+		Body   string
+	}{
+		"client certificate":    {[]tls.Certificate{client.tlsCertificate()}, http.StatusOK, "client"},
+		"no client cert":        {nil, 0, ""},
+		"untrusted client cert": {[]tls.Certificate{other.tlsCertificate()}, 0, ""},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      ca.pool(),
+				Certificates: tc.Certs,
+			}}}
+
+			resp, err := c.Get("https://" + localAddr(s.HTTPAddr()) + "/identity")
+			if tc.Status == 0 {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				assert.Equal(t, tc.Status, resp.StatusCode)
+				assert.Equal(t, tc.Body, string(body))
+			}
+		})
+	}
+
+	t.Run("gRPC client identity", func(t *testing.T) {
+		creds := credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: []tls.Certificate{client.tlsCertificate()},
+		})
+		cc, err := grpc.Dial(localAddr(s.RPCAddr()), grpc.WithTransportCredentials(creds))
+		assert.NoError(t, err)
+		defer cc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stream, err := cc.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/test.Identity/Get")
+		assert.NoError(t, err)
+		assert.NoError(t, stream.CloseSend())
+
+		md, err := stream.Header()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"client"}, md.Get("identity"))
+	})
+}
+
+func TestTLSReload(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	svc := newTLSTestService(t, ca, false)
+
+	s := New(svc)
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	serverName := func() string {
+		conn, err := tls.Dial("tcp", localAddr(s.HTTPAddr()), &tls.Config{RootCAs: ca.pool()})
+		if err != nil {
+			return ""
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "server", serverName())
+
+	// the rotated files are picked up by new connections.
+	newTestCert(t, "rotated", ca).write(t, svc.cfg.TLSCertFile, svc.cfg.TLSKeyFile)
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{svc.cfg.TLSCertFile, svc.cfg.TLSKeyFile} {
+		assert.NoError(t, os.Chtimes(file, later, later))
+	}
+
+	name := ""
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && name != "rotated"; time.Sleep(10 * time.Millisecond) {
+		name = serverName()
+	}
+	assert.Equal(t, "rotated", name)
+
+	// invalid files keep the current certificate.
+	assert.NoError(t, os.WriteFile(svc.cfg.TLSKeyFile, []byte("invalid"), 0600))
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(svc.cfg.TLSKeyFile, later, later))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "rotated", serverName())
+}
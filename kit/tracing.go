@@ -0,0 +1,130 @@
+package kit
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace exporters, see Config.TraceExporter.
+const (
+	TraceExporterStdout = "stdout"
+	TraceExporterFile   = "file"
+	TraceExporterMemory = "memory"
+)
+
+var traceExporters = []string{TraceExporterStdout, TraceExporterFile, TraceExporterMemory}
+
+// tracing owns the OpenTelemetry tracer provider of a server. No collector is
+// involved: spans are exported in-process. The provider is not registered
+// globally, so servers of the same process trace independently.
+type tracing struct {
+	cfg      Config
+	provider *sdktrace.TracerProvider
+	memory   *tracetest.InMemoryExporter
+	file     io.Closer
+}
+
+func newTracing(cfg Config) *tracing {
+	if cfg.TraceExporter == "" {
+		return nil
+	}
+
+	ratio := cfg.TraceSampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	// the provider exists before the exporter so the middleware built by New
+	// can refer to it; spans started before Start are not exported.
+	return &tracing{
+		cfg: cfg,
+		provider: sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		),
+	}
+}
+
+// start creates the exporter and registers it with the tracer provider.
+func (t *tracing) start() error {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch strings.ToLower(t.cfg.TraceExporter) {
+	case TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case TraceExporterFile:
+		if t.cfg.TraceFile == "" {
+			return errors.New("trace file is required by the file trace exporter")
+		}
+
+		var f *os.File
+		f, err = os.OpenFile(t.cfg.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return errors.Wrap(err, "unable to open trace file")
+		}
+		t.file = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+
+	case TraceExporterMemory:
+		t.memory = tracetest.NewInMemoryExporter()
+		exporter = t.memory
+
+	default:
+		return errors.Errorf("trace exporter is not one of the supported values (%s): %s", strings.Join(traceExporters, ", "), t.cfg.TraceExporter)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to create trace exporter")
+	}
+
+	// spans kept in memory are exported synchronously so tests can read them
+	// as soon as the request completes.
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	if t.memory != nil {
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+	t.provider.RegisterSpanProcessor(processor)
+
+	return nil
+}
+
+// shutdown flushes the pending spans and closes the exporter.
+func (t *tracing) shutdown(ctx context.Context) error {
+	err := t.provider.Shutdown(ctx)
+	if t.file != nil {
+		if cerr := t.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return errors.Wrap(err, "unable to shut down tracing")
+}
+
+// Spans returns the spans recorded so far when TraceExporter is "memory".
+func (s *Server) Spans() tracetest.SpanStubs {
+	if s.tracing == nil || s.tracing.memory == nil {
+		return nil
+	}
+
+	return s.tracing.memory.GetSpans()
+}
+
+// TracerProvider returns the tracer provider recording the spans of the server
+// when TraceExporter is set, or the global OpenTelemetry tracer provider. Pass
+// it to the libraries traced by the services, eg. eventsourcing.Repository.
+func (s *Server) TracerProvider() trace.TracerProvider {
+	if s.tracing == nil {
+		return otel.GetTracerProvider()
+	}
+
+	return s.tracing.provider
+}
@@ -0,0 +1,115 @@
+package kit
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insighted4/insighted-go/kit/extensions"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+// tracedService serves the test HTTP handler behind the tracing middleware,
+// as services building their own handler do.
+type tracedService struct {
+	testService
+}
+
+func (s tracedService) HTTPHandler() http.Handler {
+	handler := gin.New()
+	handler.Use(extensions.RequestIDHandler(), extensions.TracingHandler())
+	handler.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	return handler
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		assert.Nil(t, newTracing(DefaultConfig()))
+	})
+
+	t.Run("unsupported exporter", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.TraceExporter = "jaeger"
+		assert.Error(t, newTracing(cfg).start())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "tracing")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		cfg := DefaultConfig()
+		cfg.TraceExporter = TraceExporterFile
+		cfg.TraceFile = filepath.Join(dir, "spans.json")
+
+		tr := newTracing(cfg)
+		assert.NoError(t, tr.start())
+
+		_, span := tr.provider.Tracer("test").Start(context.Background(), "operation")
+		span.End()
+		assert.NoError(t, tr.shutdown(context.Background()))
+
+		data, err := ioutil.ReadFile(cfg.TraceFile)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"Name":"operation"`)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		svc := newTestService("")
+		svc.cfg.TraceExporter = TraceExporterMemory
+
+		s := New(svc)
+		assert.NoError(t, s.Start())
+		defer s.Stop()
+
+		_, span := s.TracerProvider().Tracer("test").Start(context.Background(), "operation")
+		span.End()
+
+		spans := s.Spans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "operation", spans[0].Name)
+
+		// the global provider is left untouched.
+		assert.NotEqual(t, s.TracerProvider(), otel.GetTracerProvider())
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		get := func(s *Server) {
+			resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(s.HTTPAddr().(*net.TCPAddr).Port) + "/ping")
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}
+
+		// each server records the requests it serves, whether it runs after
+		// another one or alongside it.
+		var servers []*Server
+		for i := 0; i < 2; i++ {
+			svc := tracedService{newTestService("")}
+			svc.cfg.TraceExporter = TraceExporterMemory
+
+			s := New(svc)
+			assert.NoError(t, s.Start())
+			defer s.Stop()
+			servers = append(servers, s)
+
+			get(s)
+			if assert.Len(t, s.Spans(), 1) {
+				assert.Equal(t, "GET /ping", s.Spans()[0].Name)
+			}
+		}
+
+		assert.NoError(t, servers[0].Stop())
+		get(servers[1])
+		assert.Len(t, servers[1].Spans(), 2)
+	})
+}
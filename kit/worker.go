@@ -0,0 +1,168 @@
+package kit
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Worker is a background task, such as a cron job, a queue consumer or a cache
+// warmer, whose lifecycle is managed by the server.
+//
+// Run should block until ctx is cancelled. Workers returning an error (or
+// panicking) are restarted with an exponential backoff; workers returning nil
+// before ctx is cancelled are considered done and are not restarted.
+type Worker interface {
+	// Name identifies the worker in logs and errors.
+	Name() string
+
+	Run(ctx context.Context) error
+}
+
+// WorkerFunc adapts an ordinary function into a Worker with the given name.
+func WorkerFunc(name string, fn func(ctx context.Context) error) Worker {
+	return workerFunc{name: name, fn: fn}
+}
+
+type workerFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Name implements the Worker interface.
+func (w workerFunc) Name() string {
+	return w.name
+}
+
+// Run implements the Worker interface.
+func (w workerFunc) Run(ctx context.Context) error {
+	return w.fn(ctx)
+}
+
+// WorkerService can be implemented by services to register their workers.
+// Workers are started, in order, with the listeners and stopped in reverse order.
+type WorkerService interface {
+	Workers() []Worker
+}
+
+type worker struct {
+	name   string
+	worker Worker
+	logger logrus.FieldLogger
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// AddWorker registers a worker with the server. It must be called before Start.
+func (s *Server) AddWorker(w Worker) {
+	s.workers = append(s.workers, &worker{
+		name:   w.Name(),
+		worker: w,
+		logger: s.logger.WithField("worker", w.Name()),
+	})
+}
+
+func (s *Server) startWorkers() {
+	for _, w := range s.workers {
+		ctx, cancel := context.WithCancel(context.Background())
+		w.cancel = cancel
+		w.done = make(chan struct{})
+
+		go w.supervise(ctx, s.config.WorkerBackoff, s.config.WorkerMaxBackoff)
+		w.logger.Info("Started worker")
+	}
+}
+
+// stopWorkers cancels the workers in reverse order, waiting for each to return
+// until ctx expires. The worker that failed to stop in time is reported, as
+// are the workers still running once it timed out: these are cancelled
+// without being waited for.
+func (s *Server) stopWorkers(ctx context.Context) error {
+	var errs Errors
+	var stuck *worker
+	for i := len(s.workers) - 1; i >= 0; i-- {
+		w := s.workers[i]
+		if w.cancel == nil {
+			continue
+		}
+
+		w.cancel()
+		if stuck != nil {
+			select {
+			case <-w.done:
+				w.logger.Info("Stopped worker")
+			default:
+				w.logger.Error("Worker not stopped")
+				errs = append(errs, errors.Errorf("worker %s not stopped: worker %s did not stop in time", w.name, stuck.name))
+			}
+			continue
+		}
+
+		select {
+		case <-w.done:
+			w.logger.Info("Stopped worker")
+		case <-ctx.Done():
+			w.logger.Error("Worker did not stop in time")
+			errs = append(errs, errors.Errorf("worker %s did not stop in time", w.name))
+			stuck = w
+		}
+	}
+
+	return errs.err()
+}
+
+// supervise runs the worker until ctx is cancelled, restarting it with an
+// exponential backoff when it fails.
+func (w *worker) supervise(ctx context.Context, minBackoff, maxBackoff time.Duration) {
+	defer close(w.done)
+
+	if minBackoff <= 0 {
+		minBackoff = time.Second
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	backoff := minBackoff
+	for {
+		start := time.Now()
+		err := w.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			w.logger.Info("Worker finished")
+			return
+		}
+
+		// a worker that ran for a while is considered healthy again.
+		if time.Since(start) > maxBackoff {
+			backoff = minBackoff
+		}
+
+		w.logger.Errorf("Worker failed, restarting in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (w *worker) run(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+
+	return w.worker.Run(ctx)
+}
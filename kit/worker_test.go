@@ -0,0 +1,87 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWorkerTestServer() *Server {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	cfg := DefaultConfig()
+	cfg.WorkerBackoff = time.Millisecond
+	cfg.WorkerMaxBackoff = 5 * time.Millisecond
+	return &Server{config: cfg, logger: logger}
+}
+
+func TestWorkerRestart(t *testing.T) {
+	s := newWorkerTestServer()
+
+	var runs int32
+	restarted := make(chan struct{})
+	s.AddWorker(WorkerFunc("flaky", func(ctx context.Context) error {
+		switch atomic.AddInt32(&runs, 1) {
+		case 1:
+			return errors.New("boom")
+		case 2:
+			panic("boom")
+		case 3:
+			close(restarted)
+		}
+		<-ctx.Done()
+		return nil
+	}))
+
+	s.startWorkers()
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("worker was not restarted")
+	}
+
+	assert.NoError(t, s.stopWorkers(context.Background()))
+}
+
+func TestStopWorkers(t *testing.T) {
+	s := newWorkerTestServer()
+
+	var order []string
+	block := make(chan struct{})
+	defer close(block)
+
+	s.AddWorker(WorkerFunc("ignoring", func(ctx context.Context) error {
+		<-block
+		return nil
+	}))
+	s.AddWorker(WorkerFunc("stuck", func(ctx context.Context) error {
+		<-block
+		return nil
+	}))
+	s.AddWorker(WorkerFunc("first", func(ctx context.Context) error {
+		<-ctx.Done()
+		order = append(order, "first")
+		return nil
+	}))
+	s.AddWorker(WorkerFunc("second", func(ctx context.Context) error {
+		<-ctx.Done()
+		order = append(order, "second")
+		return nil
+	}))
+
+	s.startWorkers()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// only stuck timed out: ignoring was cancelled without being waited for.
+	err := s.stopWorkers(ctx)
+	assert.EqualError(t, err, "worker stuck did not stop in time; worker ignoring not stopped: worker stuck did not stop in time")
+	assert.Equal(t, []string{"second", "first"}, order)
+}